@@ -0,0 +1,494 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// DBInstanceClassSpec is used to store the capacity of a DB instance class the alarm templates are rendered for.
+type DBInstanceClassSpec struct {
+	Class          string
+	Memory         float64
+	VCPU           int
+	MaxConnections float64
+}
+
+// AlarmSettings is used to store the settings shared by all the alarm templates. Zero values are not configured:
+// existing alarms keep their value and missing alarms are created with the defaults.
+type AlarmSettings struct {
+	Period                    int64
+	EvaluationPeriods         int64
+	DatapointsToAlarm         int64
+	TreatMissingData          string
+	MemoryThresholdPercentage float64
+	AlarmActions              []string
+}
+
+// AlarmTemplate is used to define a Cloudwatch alarm of a DB instance. The alarm is either a single metric alarm
+// (MetricName) or a metric math alarm (Metrics), and its threshold is a function of the DB instance class capacity.
+type AlarmTemplate struct {
+	NameSuffix         string
+	Description        string
+	ComparisonOperator string
+	MetricName         string
+	Statistic          string
+	Metrics            func(dbInstanceIdentifier string, spec DBInstanceClassSpec, settings AlarmSettings) []*cloudwatch.MetricDataQuery
+	Threshold          func(spec DBInstanceClassSpec, settings AlarmSettings) (float64, error)
+}
+
+// AlarmTemplates are the Cloudwatch alarms every multitenant DB instance has.
+var AlarmTemplates = []AlarmTemplate{
+	{
+		NameSuffix:         "memory",
+		Description:        "Available memory (freeable memory plus the reclaimable buffer cache) of the DB instance is low",
+		ComparisonOperator: cloudwatch.ComparisonOperatorLessThanThreshold,
+		Metrics: func(dbInstanceIdentifier string, spec DBInstanceClassSpec, settings AlarmSettings) []*cloudwatch.MetricDataQuery {
+			return []*cloudwatch.MetricDataQuery{
+				{
+					Id: aws.String("m1"),
+					MetricStat: &cloudwatch.MetricStat{
+						Metric: &cloudwatch.Metric{
+							Namespace:  aws.String("AWS/RDS"),
+							MetricName: aws.String("FreeableMemory"),
+							Dimensions: []*cloudwatch.Dimension{{Name: aws.String("DBInstanceIdentifier"), Value: aws.String(dbInstanceIdentifier)}},
+						},
+						Period: settings.period(),
+						Stat:   aws.String(cloudwatch.StatisticAverage),
+					},
+					ReturnData: aws.Bool(false),
+				},
+				{
+					Id:         aws.String("e1"),
+					Expression: aws.String(fmt.Sprintf("m1 + %s*%.0f", os.Getenv("MemoryCacheProportion"), spec.Memory)),
+					Label:      aws.String("AvailableMemory"),
+					ReturnData: aws.Bool(true),
+				},
+			}
+		},
+		Threshold: func(spec DBInstanceClassSpec, settings AlarmSettings) (float64, error) {
+			return settings.MemoryThresholdPercentage / 100 * spec.Memory, nil
+		},
+	},
+	{
+		NameSuffix:         "connections",
+		Description:        "Database connections of the DB instance are close to the maximum connections",
+		ComparisonOperator: cloudwatch.ComparisonOperatorGreaterThanThreshold,
+		MetricName:         "DatabaseConnections",
+		Statistic:          cloudwatch.StatisticAverage,
+		Threshold: func(spec DBInstanceClassSpec, settings AlarmSettings) (float64, error) {
+			connectionsSafetyPercentage, err := strconv.ParseFloat(os.Getenv("ConnectionsSafetyPercentage"), 64)
+			if err != nil {
+				return 0, errors.Wrap(err, "failed to parse float64 from ConnectionsSafetyPercentage string")
+			}
+			return connectionsSafetyPercentage * spec.MaxConnections, nil
+		},
+	},
+}
+
+// getDBInstanceClassSpec returns the capacity of the provisioned DB instance class. The max connections are evaluated from the
+// max_connections DB parameter when it is set, otherwise they are approximated from the class memory and the
+// MemoryConnectionsDivider.
+func getDBInstanceClassSpec(class, maxConnectionsParameter string) (DBInstanceClassSpec, error) {
+	memory, err := getClassMemory(class)
+	if err != nil {
+		return DBInstanceClassSpec{}, err
+	}
+	spec := DBInstanceClassSpec{
+		Class:  class,
+		Memory: memory,
+		VCPU:   DBInstanceClassVCPU[class],
+	}
+	err = spec.setMaxConnections(maxConnectionsParameter)
+	return spec, err
+}
+
+func (s *DBInstanceClassSpec) setMaxConnections(maxConnectionsParameter string) error {
+	if maxConnectionsParameter != "" {
+		maxConnections, err := evaluateParameterFormula(maxConnectionsParameter, *s)
+		if err != nil {
+			return errors.Wrap(err, "failed to evaluate max_connections parameter")
+		}
+		s.MaxConnections = maxConnections
+		return nil
+	}
+
+	divider, err := strconv.ParseFloat(os.Getenv("MemoryConnectionsDivider"), 64)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse float64 from MemoryConnectionsDivider string")
+	}
+	s.MaxConnections = s.Memory / divider
+	return nil
+}
+
+// getAlarmSettings returns the alarm settings configured with the environment variables.
+func getAlarmSettings() (AlarmSettings, error) {
+	var settings AlarmSettings
+	integers := []struct {
+		envVar string
+		value  *int64
+	}{
+		{"AlarmPeriod", &settings.Period},
+		{"AlarmEvaluationPeriods", &settings.EvaluationPeriods},
+		{"AlarmDatapointsToAlarm", &settings.DatapointsToAlarm},
+	}
+	for _, integer := range integers {
+		if os.Getenv(integer.envVar) == "" {
+			continue
+		}
+		value, err := strconv.ParseInt(os.Getenv(integer.envVar), 10, 64)
+		if err != nil {
+			return settings, errors.Wrapf(err, "failed to parse int64 from %s string", integer.envVar)
+		}
+		*integer.value = value
+	}
+	if settings.DatapointsToAlarm == 0 {
+		settings.DatapointsToAlarm = settings.EvaluationPeriods
+	}
+
+	if os.Getenv("MemoryAlarmThresholdPercentage") != "" {
+		var err error
+		settings.MemoryThresholdPercentage, err = strconv.ParseFloat(os.Getenv("MemoryAlarmThresholdPercentage"), 64)
+		if err != nil {
+			return settings, errors.Wrap(err, "failed to parse float64 from MemoryAlarmThresholdPercentage string")
+		}
+	}
+	settings.TreatMissingData = os.Getenv("AlarmTreatMissingData")
+	for _, action := range strings.Split(os.Getenv("AlarmActions"), ",") {
+		if strings.TrimSpace(action) != "" {
+			settings.AlarmActions = append(settings.AlarmActions, strings.TrimSpace(action))
+		}
+	}
+	return settings, nil
+}
+
+// withDefaults returns the settings with the defaults the missing alarms are created with.
+func (s AlarmSettings) withDefaults() AlarmSettings {
+	if s.Period == 0 {
+		s.Period = 60
+	}
+	if s.EvaluationPeriods == 0 {
+		s.EvaluationPeriods = 5
+	}
+	if s.DatapointsToAlarm == 0 {
+		s.DatapointsToAlarm = s.EvaluationPeriods
+	}
+	if s.TreatMissingData == "" {
+		s.TreatMissingData = "missing"
+	}
+	if s.MemoryThresholdPercentage == 0 {
+		s.MemoryThresholdPercentage = 10
+	}
+	return s
+}
+
+func (s AlarmSettings) period() *int64 {
+	if s.Period == 0 {
+		return nil
+	}
+	return aws.Int64(s.Period)
+}
+
+// alarmName returns the name of the alarm of the DB instance.
+func (t AlarmTemplate) alarmName(dbInstanceIdentifier string) string {
+	return fmt.Sprintf("%s-%s", dbInstanceIdentifier, t.NameSuffix)
+}
+
+// render returns the alarm of the DB instance for the DB instance class. The attributes whose settings are not
+// configured are left nil, as is the threshold when it evaluates to zero.
+func (t AlarmTemplate) render(dbInstanceIdentifier string, spec DBInstanceClassSpec, settings AlarmSettings) (*cloudwatch.PutMetricAlarmInput, error) {
+	threshold, err := t.Threshold(spec, settings)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to calculate %s alarm threshold", t.NameSuffix)
+	}
+
+	alarm := &cloudwatch.PutMetricAlarmInput{
+		AlarmName:          aws.String(t.alarmName(dbInstanceIdentifier)),
+		AlarmDescription:   aws.String(t.Description),
+		ComparisonOperator: aws.String(t.ComparisonOperator),
+	}
+	if threshold != 0 {
+		alarm.Threshold = aws.Float64(threshold)
+	}
+	if settings.EvaluationPeriods != 0 {
+		alarm.EvaluationPeriods = aws.Int64(settings.EvaluationPeriods)
+	}
+	if settings.DatapointsToAlarm != 0 {
+		alarm.DatapointsToAlarm = aws.Int64(settings.DatapointsToAlarm)
+	}
+	if settings.TreatMissingData != "" {
+		alarm.TreatMissingData = aws.String(settings.TreatMissingData)
+	}
+	if len(settings.AlarmActions) > 0 {
+		alarm.AlarmActions = aws.StringSlice(settings.AlarmActions)
+	}
+	if t.Metrics != nil {
+		alarm.Metrics = t.Metrics(dbInstanceIdentifier, spec, settings)
+	} else {
+		alarm.Namespace = aws.String("AWS/RDS")
+		alarm.MetricName = aws.String(t.MetricName)
+		alarm.Statistic = aws.String(t.Statistic)
+		alarm.Period = settings.period()
+		alarm.Dimensions = []*cloudwatch.Dimension{{Name: aws.String("DBInstanceIdentifier"), Value: aws.String(dbInstanceIdentifier)}}
+	}
+	return alarm, nil
+}
+
+// AlarmDrift is used to store the difference between an existing alarm and its expected definition.
+type AlarmDrift struct {
+	AlarmName string
+	Missing   bool
+	Changes   []string
+}
+
+// reconcileDBInstanceAlarms compares all the alarms of the DB instance with the templates rendered for the DB instance
+// class and returns the drifted ones. When fix is true the missing alarms are created and the drifted ones updated.
+func reconcileDBInstanceAlarms(ctx context.Context, logger *log.Entry, RDSClient *rds.RDS, client *cloudwatch.CloudWatch, dbInstanceIdentifier, class string, fix bool) ([]AlarmDrift, error) {
+	maxConnectionsParameter, err := getMaxConnectionsParameter(RDSClient, dbInstanceIdentifier)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get max_connections parameter")
+	}
+	var spec DBInstanceClassSpec
+	if class == DBInstanceClassServerless {
+		spec, err = getServerlessV2ClassSpec(RDSClient, dbInstanceIdentifier, maxConnectionsParameter)
+	} else {
+		spec, err = getDBInstanceClassSpec(class, maxConnectionsParameter)
+	}
+	if err != nil {
+		return nil, err
+	}
+	logger.Infof("DB instance (%s) class (%s) has %.0f max connections", dbInstanceIdentifier, class, spec.MaxConnections)
+	settings, err := getAlarmSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	var drifts []AlarmDrift
+	for _, template := range AlarmTemplates {
+		configured, err := template.render(dbInstanceIdentifier, spec, settings)
+		if err != nil {
+			return drifts, err
+		}
+		expected, err := template.render(dbInstanceIdentifier, spec, settings.withDefaults())
+		if err != nil {
+			return drifts, err
+		}
+		_, alarmSpan := startSpan(ctx, "cloudwatch.reconcileAlarm", "alarm", *expected.AlarmName)
+		drift, err := reconcileAlarm(logger.WithField("alarm", *expected.AlarmName), client, configured, expected, fix)
+		endSpan(alarmSpan, err)
+		if err != nil {
+			return drifts, errors.Wrapf(err, "Failed to reconcile Cloudwatch alarm (%s)", *expected.AlarmName)
+		}
+		if drift != nil {
+			drifts = append(drifts, *drift)
+		}
+	}
+	return drifts, nil
+}
+
+// reconcileAlarm compares the alarm with its expected definition and returns the drift, or nil when the alarm is up
+// to date. When fix is true a missing alarm is created with the expected definition, which has the defaults applied,
+// and the configured definition is applied to a drifted alarm. The attributes whose settings are not configured are
+// kept, as are the attributes not defined by the templates, such as the OK and insufficient data actions.
+func reconcileAlarm(logger *log.Entry, client *cloudwatch.CloudWatch, configured, expected *cloudwatch.PutMetricAlarmInput, fix bool) (*AlarmDrift, error) {
+	alarms, err := client.DescribeAlarms(&cloudwatch.DescribeAlarmsInput{
+		AlarmNames: []*string{expected.AlarmName},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to describe Cloudwatch alarms")
+	}
+
+	drift := &AlarmDrift{AlarmName: *expected.AlarmName}
+	updated := expected
+	if len(alarms.MetricAlarms) == 0 {
+		drift.Missing = true
+		if !fix {
+			logger.Warnf("Cloudwatch alarm (%s) is missing", *expected.AlarmName)
+			return drift, nil
+		}
+		if len(expected.AlarmActions) == 0 {
+			return nil, errors.New("AlarmActions must be set to create missing alarms")
+		}
+		logger.Infof("Creating missing Cloudwatch alarm (%s)", *expected.AlarmName)
+	} else {
+		tags, err := client.ListTagsForResource(&cloudwatch.ListTagsForResourceInput{ResourceARN: alarms.MetricAlarms[0].AlarmArn})
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to list Cloudwatch alarm tags")
+		}
+		current := metricAlarmToPutMetricAlarmInput(alarms.MetricAlarms[0], tags.Tags)
+		updated = applyAlarmTemplate(current, configured, expected)
+
+		drift.Changes = diffAlarms(current, updated)
+		if len(drift.Changes) == 0 {
+			logger.Infof("Cloudwatch alarm (%s) is up to date", *expected.AlarmName)
+			return nil, nil
+		}
+		if !fix {
+			logger.Warnf("Cloudwatch alarm (%s) drifted: %s", *expected.AlarmName, strings.Join(drift.Changes, "; "))
+			return drift, nil
+		}
+		logger.Infof("Updating Cloudwatch alarm (%s): %s", *expected.AlarmName, strings.Join(drift.Changes, "; "))
+	}
+
+	_, err = client.PutMetricAlarm(updated)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to put Cloudwatch alarm")
+	}
+	metrics.AlarmUpdates.Inc()
+	return drift, nil
+}
+
+// metricAlarmToPutMetricAlarmInput returns the input that recreates the existing alarm with all its attributes.
+func metricAlarmToPutMetricAlarmInput(alarm *cloudwatch.MetricAlarm, tags []*cloudwatch.Tag) *cloudwatch.PutMetricAlarmInput {
+	return &cloudwatch.PutMetricAlarmInput{
+		ActionsEnabled:                   alarm.ActionsEnabled,
+		AlarmActions:                     alarm.AlarmActions,
+		AlarmDescription:                 alarm.AlarmDescription,
+		AlarmName:                        alarm.AlarmName,
+		ComparisonOperator:               alarm.ComparisonOperator,
+		DatapointsToAlarm:                alarm.DatapointsToAlarm,
+		Dimensions:                       alarm.Dimensions,
+		EvaluateLowSampleCountPercentile: alarm.EvaluateLowSampleCountPercentile,
+		EvaluationPeriods:                alarm.EvaluationPeriods,
+		ExtendedStatistic:                alarm.ExtendedStatistic,
+		InsufficientDataActions:          alarm.InsufficientDataActions,
+		MetricName:                       alarm.MetricName,
+		Metrics:                          alarm.Metrics,
+		Namespace:                        alarm.Namespace,
+		OKActions:                        alarm.OKActions,
+		Period:                           alarm.Period,
+		Statistic:                        alarm.Statistic,
+		Tags:                             tags,
+		Threshold:                        alarm.Threshold,
+		ThresholdMetricId:                alarm.ThresholdMetricId,
+		TreatMissingData:                 alarm.TreatMissingData,
+		Unit:                             alarm.Unit,
+	}
+}
+
+// applyAlarmTemplate returns the existing alarm definition with the class dependent attributes of the rendered
+// template and the configured settings applied. The description, the comparison operator and the settings which are
+// not configured are kept. When the alarm does not have the metrics of the template, they are replaced by the metrics
+// of the expected definition.
+func applyAlarmTemplate(current, configured, expected *cloudwatch.PutMetricAlarmInput) *cloudwatch.PutMetricAlarmInput {
+	updated := *current
+	if configured.Threshold != nil {
+		updated.Threshold = configured.Threshold
+	}
+	if configured.EvaluationPeriods != nil {
+		updated.EvaluationPeriods = configured.EvaluationPeriods
+	}
+	if configured.DatapointsToAlarm != nil {
+		updated.DatapointsToAlarm = configured.DatapointsToAlarm
+	}
+	if configured.TreatMissingData != nil {
+		updated.TreatMissingData = configured.TreatMissingData
+	}
+	if len(configured.AlarmActions) > 0 {
+		updated.AlarmActions = configured.AlarmActions
+	}
+
+	if expected.Metrics != nil {
+		metrics, ok := applyMetricQueries(current.Metrics, configured.Metrics)
+		if !ok {
+			metrics = expected.Metrics
+		}
+		updated.Metrics = metrics
+		updated.Namespace = nil
+		updated.MetricName = nil
+		updated.Statistic = nil
+		updated.ExtendedStatistic = nil
+		updated.EvaluateLowSampleCountPercentile = nil
+		updated.Period = nil
+		updated.Dimensions = nil
+		updated.Unit = nil
+		return &updated
+	}
+
+	if current.Metrics == nil && aws.StringValue(current.MetricName) == aws.StringValue(expected.MetricName) {
+		if configured.Period != nil {
+			updated.Period = configured.Period
+		}
+		return &updated
+	}
+	updated.Metrics = nil
+	updated.ThresholdMetricId = nil
+	updated.Namespace = expected.Namespace
+	updated.MetricName = expected.MetricName
+	updated.Statistic = expected.Statistic
+	updated.ExtendedStatistic = nil
+	updated.EvaluateLowSampleCountPercentile = nil
+	updated.Period = expected.Period
+	updated.Dimensions = expected.Dimensions
+	return &updated
+}
+
+// applyMetricQueries returns a copy of the current metric queries with the expressions and the configured periods of
+// the template queries applied. It returns false when a template query is missing from the current queries.
+func applyMetricQueries(current, template []*cloudwatch.MetricDataQuery) ([]*cloudwatch.MetricDataQuery, bool) {
+	if current == nil {
+		return nil, false
+	}
+	updated := make([]*cloudwatch.MetricDataQuery, len(current))
+	indexes := make(map[string]int)
+	for i, query := range current {
+		copied := *query
+		if query.MetricStat != nil {
+			metricStat := *query.MetricStat
+			copied.MetricStat = &metricStat
+		}
+		updated[i] = &copied
+		indexes[aws.StringValue(query.Id)] = i
+	}
+
+	for _, query := range template {
+		i, ok := indexes[aws.StringValue(query.Id)]
+		if !ok {
+			return nil, false
+		}
+		if query.Expression != nil {
+			updated[i].Expression = query.Expression
+		}
+		if query.MetricStat != nil && query.MetricStat.Period != nil && updated[i].MetricStat != nil {
+			updated[i].MetricStat.Period = query.MetricStat.Period
+		}
+	}
+	return updated, true
+}
+
+// diffAlarms returns the attributes that differ between the two alarm definitions, with their old and new values.
+func diffAlarms(current, updated *cloudwatch.PutMetricAlarmInput) []string {
+	var changes []string
+	currentValue := reflect.ValueOf(*current)
+	updatedValue := reflect.ValueOf(*updated)
+	for i := 0; i < currentValue.NumField(); i++ {
+		field := currentValue.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		before := prettifyAlarmAttribute(currentValue.Field(i))
+		after := prettifyAlarmAttribute(updatedValue.Field(i))
+		if before != after {
+			changes = append(changes, fmt.Sprintf("%s: %s -> %s", field.Name, before, after))
+		}
+	}
+	return changes
+}
+
+// prettifyAlarmAttribute returns the alarm attribute on a single line, or none when it is not set.
+func prettifyAlarmAttribute(value reflect.Value) string {
+	if value.Kind() == reflect.Ptr && value.IsNil() {
+		return "none"
+	}
+	return strings.Join(strings.Fields(awsutil.Prettify(value.Interface())), " ")
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+)
+
+func TestDiffAlarms(t *testing.T) {
+	newAlarm := func(update func(alarm *cloudwatch.PutMetricAlarmInput)) *cloudwatch.PutMetricAlarmInput {
+		alarm := &cloudwatch.PutMetricAlarmInput{
+			AlarmName:          aws.String("db-1-cpu"),
+			ComparisonOperator: aws.String(cloudwatch.ComparisonOperatorGreaterThanThreshold),
+			Threshold:          aws.Float64(80),
+			Period:             aws.Int64(60),
+			Dimensions:         []*cloudwatch.Dimension{{Name: aws.String("DBInstanceIdentifier"), Value: aws.String("db-1")}},
+		}
+		if update != nil {
+			update(alarm)
+		}
+		return alarm
+	}
+
+	tests := []struct {
+		name     string
+		current  *cloudwatch.PutMetricAlarmInput
+		updated  *cloudwatch.PutMetricAlarmInput
+		expected []string
+	}{
+		{name: "identical", current: newAlarm(nil), updated: newAlarm(nil)},
+		{
+			name:     "threshold",
+			current:  newAlarm(nil),
+			updated:  newAlarm(func(alarm *cloudwatch.PutMetricAlarmInput) { alarm.Threshold = aws.Float64(90) }),
+			expected: []string{"Threshold: 80 -> 90"},
+		},
+		{
+			name:     "attribute set",
+			current:  newAlarm(nil),
+			updated:  newAlarm(func(alarm *cloudwatch.PutMetricAlarmInput) { alarm.EvaluationPeriods = aws.Int64(5) }),
+			expected: []string{"EvaluationPeriods: none -> 5"},
+		},
+		{
+			name:     "attribute unset",
+			current:  newAlarm(nil),
+			updated:  newAlarm(func(alarm *cloudwatch.PutMetricAlarmInput) { alarm.Period = nil }),
+			expected: []string{"Period: 60 -> none"},
+		},
+		{
+			name:    "several attributes",
+			current: newAlarm(nil),
+			updated: newAlarm(func(alarm *cloudwatch.PutMetricAlarmInput) {
+				alarm.Dimensions[0].Value = aws.String("db-2")
+				alarm.ComparisonOperator = aws.String(cloudwatch.ComparisonOperatorGreaterThanOrEqualToThreshold)
+			}),
+			expected: []string{
+				`ComparisonOperator: "GreaterThanThreshold" -> "GreaterThanOrEqualToThreshold"`,
+				`Dimensions: [{ Name: "DBInstanceIdentifier", Value: "db-1" }] -> [{ Name: "DBInstanceIdentifier", Value: "db-2" }]`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes := diffAlarms(test.current, test.updated)
+			if !reflect.DeepEqual(changes, test.expected) {
+				t.Errorf("expected %q, got %q", test.expected, changes)
+			}
+		})
+	}
+}
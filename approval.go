@@ -0,0 +1,319 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	model "github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Approval statuses of a PendingApproval.
+const (
+	ApprovalStatusPending  = "pending"
+	ApprovalStatusApproved = "approved"
+	ApprovalStatusRejected = "rejected"
+)
+
+// PendingApproval is used to store a scaling action waiting for a human to approve it.
+type PendingApproval struct {
+	ID          string        `json:"id"`
+	Action      PendingAction `json:"action"`
+	Reason      string        `json:"reason"`
+	Status      string        `json:"status"`
+	DecidedBy   string        `json:"decidedBy"`
+	RequestedAt time.Time     `json:"requestedAt"`
+	ExpiresAt   time.Time     `json:"expiresAt"`
+}
+
+func isApprovalEnabled() bool {
+	return os.Getenv("ApprovalCallbackURL") != ""
+}
+
+// getApprovalReason returns the reason the scaling to the new class needs a human approval, or an empty string when
+// it can proceed. Writer failovers need an approval when ApprovalForWriterFailover is set and class jumps need an
+// approval when the new class has more than ApprovalJumpRatio times the memory of the current class.
+func (d *DBInstance) getApprovalReason(newClass string) (string, error) {
+	if !isApprovalEnabled() {
+		return "", nil
+	}
+	if os.Getenv("ApprovalToken") == "" {
+		return "", errors.New("ApprovalToken must be set when ApprovalCallbackURL is set")
+	}
+
+	if os.Getenv("ApprovalForWriterFailover") == "true" && d.IsClusterWriter {
+		return fmt.Sprintf("DB instance (%s) is the writer and scaling it requires a failover", d.DBInstanceIdentifier), nil
+	}
+
+	if os.Getenv("ApprovalJumpRatio") != "" {
+		ratio, err := strconv.ParseFloat(os.Getenv("ApprovalJumpRatio"), 64)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to parse float64 from ApprovalJumpRatio string")
+		}
+		currentMemory, err := getClassMemory(d.DBInstanceClass)
+		if err != nil {
+			return "", err
+		}
+		newMemory, err := getClassMemory(newClass)
+		if err != nil {
+			return "", err
+		}
+		if newMemory/currentMemory > ratio {
+			return fmt.Sprintf("Class (%s) has %.1f times the memory of class (%s)", newClass, newMemory/currentMemory, d.DBInstanceClass), nil
+		}
+	}
+	return "", nil
+}
+
+// requestApproval stores the scaling action and posts an interactive message asking for its approval.
+func (d *DBInstance) requestApproval(newClass, alarmName, reason string) error {
+	return d.requestActionApproval(d.newPendingAction(newClass, alarmName), reason)
+}
+
+// newPendingAction returns the scaling action of the DB instance to the new class.
+func (d *DBInstance) newPendingAction(newClass, alarmName string) PendingAction {
+	return PendingAction{
+		DBInstanceIdentifier: d.DBInstanceIdentifier,
+		DBClusterIdentifier:  d.DBClusterIdentifier,
+		CurrentClass:         d.DBInstanceClass,
+		NewClass:             newClass,
+		AlarmName:            alarmName,
+		CorrelationID:        d.CorrelationID,
+	}
+}
+
+func (d *DBInstance) requestActionApproval(action PendingAction, reason string) error {
+	timeout := time.Hour
+	if os.Getenv("ApprovalTimeout") != "" {
+		var err error
+		timeout, err = time.ParseDuration(os.Getenv("ApprovalTimeout"))
+		if err != nil {
+			return errors.Wrap(err, "failed to parse ApprovalTimeout")
+		}
+	}
+
+	now := time.Now().UTC()
+	approval := PendingApproval{
+		ID:          model.NewId(),
+		Action:      action,
+		Reason:      reason,
+		Status:      ApprovalStatusPending,
+		RequestedAt: now,
+		ExpiresAt:   now.Add(timeout),
+	}
+	requested := true
+	err := updateState(func(state *State) error {
+		for _, pending := range state.PendingApprovals {
+			if pending.Action.DBInstanceIdentifier == d.DBInstanceIdentifier {
+				d.stepLogger("requestApproval").Infof("DB instance (%s) already has a scaling action to (%s) waiting for approval", d.DBInstanceIdentifier, pending.Action.NewClass)
+				requested = false
+				return nil
+			}
+		}
+		state.PendingApprovals = append(state.PendingApprovals, approval)
+		return nil
+	})
+	if err != nil || !requested {
+		return err
+	}
+
+	d.stepLogger("requestApproval").Infof("Vertical scaling of DB instance (%s) to (%s) requires approval: %s", d.DBInstanceIdentifier, action.NewClass, reason)
+	err = d.sendMattermostApprovalRequest(approval)
+	if err != nil {
+		return errors.Wrap(err, "failed to send Mattermost approval request")
+	}
+	return nil
+}
+
+// processPendingApprovals applies the decisions stored by the approval endpoint and the timeout default, and executes
+// the approved scaling actions. Approved actions stay in the state until they are executed, so that a failed run
+// retries them.
+func processPendingApprovals() error {
+	now := time.Now().UTC()
+	var approved, rejected []PendingApproval
+	err := updateState(func(state *State) error {
+		var remaining []PendingApproval
+		for _, approval := range state.PendingApprovals {
+			if approval.Status == ApprovalStatusPending && now.After(approval.ExpiresAt) {
+				approval.Status = ApprovalStatusRejected
+				if os.Getenv("ApprovalTimeoutAction") == "approve" {
+					approval.Status = ApprovalStatusApproved
+				}
+				approval.DecidedBy = "timeout"
+			}
+			switch approval.Status {
+			case ApprovalStatusApproved:
+				approved = append(approved, approval)
+				remaining = append(remaining, approval)
+			case ApprovalStatusRejected:
+				rejected = append(rejected, approval)
+			default:
+				remaining = append(remaining, approval)
+			}
+		}
+		state.PendingApprovals = remaining
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "Failed to update pending approvals")
+	}
+
+	for _, approval := range rejected {
+		log.Infof("Vertical scaling of DB instance (%s) to (%s) was rejected by %s", approval.Action.DBInstanceIdentifier, approval.Action.NewClass, approval.DecidedBy)
+		dbInstance := DBInstance{DBInstanceIdentifier: approval.Action.DBInstanceIdentifier, DBClusterIdentifier: approval.Action.DBClusterIdentifier, CorrelationID: approval.Action.CorrelationID}
+		err = dbInstance.sendMattermostSuppressedNotification(fmt.Sprintf("Vertical scaling to (%s) was rejected by %s", approval.Action.NewClass, approval.DecidedBy))
+		if err != nil {
+			log.WithError(err).Error("failed to send Mattermost notification")
+		}
+	}
+	if len(approved) == 0 {
+		return nil
+	}
+
+	clients, err := getAWSClients()
+	if err != nil {
+		return errors.Wrap(err, "Failed to initiate AWS Clients")
+	}
+
+	suppression, err := getScalingSuppression(clients.SSM, now)
+	if err != nil {
+		return errors.Wrap(err, "Failed to check if vertical scaling is suppressed")
+	}
+	if suppression != "" {
+		log.Warnf("%s. Keeping %d approved scaling actions pending", suppression, len(approved))
+		return nil
+	}
+
+	failures := 0
+	for _, approval := range approved {
+		log.Infof("Vertical scaling of DB instance (%s) to (%s) was approved by %s", approval.Action.DBInstanceIdentifier, approval.Action.NewClass, approval.DecidedBy)
+		err = executePendingAction(clients.RDS, clients.CloudWatch, approval.Action, true)
+		if errors.Cause(err) == errScalingSuppressed {
+			continue
+		}
+		if err != nil {
+			failures++
+			log.WithError(err).Errorf("Failed to execute approved scaling of DB instance (%s), retrying in the next run", approval.Action.DBInstanceIdentifier)
+			continue
+		}
+		err = removePendingApproval(approval.ID)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to remove approved scaling of DB instance (%s) from state", approval.Action.DBInstanceIdentifier)
+		}
+	}
+	if failures > 0 {
+		return errors.Errorf("Failed to execute %d approved scaling actions", failures)
+	}
+	return nil
+}
+
+// removePendingApproval removes the approval from the state.
+func removePendingApproval(id string) error {
+	return updateState(func(state *State) error {
+		var approvals []PendingApproval
+		for _, approval := range state.PendingApprovals {
+			if approval.ID != id {
+				approvals = append(approvals, approval)
+			}
+		}
+		state.PendingApprovals = approvals
+		return nil
+	})
+}
+
+// startApprovalServer starts the HTTP server receiving the Mattermost interactive message actions.
+func startApprovalServer() *http.Server {
+	address := ":8080"
+	if os.Getenv("ApprovalListenAddress") != "" {
+		address = os.Getenv("ApprovalListenAddress")
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/approval", handleApprovalAction)
+	server := &http.Server{
+		Addr:         address,
+		Handler:      mux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		log.Infof("Listening for approval actions on %s", address)
+		err := server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			log.WithError(err).Error("Approval server failed")
+		}
+	}()
+	return server
+}
+
+func handleApprovalAction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request model.PostActionIntegrationRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "unable to decode request", http.StatusBadRequest)
+		return
+	}
+
+	token, _ := request.Context["token"].(string)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(os.Getenv("ApprovalToken"))) != 1 {
+		log.Warnf("Approval action from user (%s) with invalid token rejected", request.UserName)
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	id, _ := request.Context["approval_id"].(string)
+	decision, _ := request.Context["decision"].(string)
+	if decision != "approve" && decision != "reject" {
+		http.Error(w, "invalid decision", http.StatusBadRequest)
+		return
+	}
+
+	// The decision is stored in the state, so that it is not lost when the daemon restarts before applying it.
+	var approval *PendingApproval
+	err = updateState(func(state *State) error {
+		for i := range state.PendingApprovals {
+			if state.PendingApprovals[i].ID == id && state.PendingApprovals[i].Status == ApprovalStatusPending {
+				approval = &state.PendingApprovals[i]
+				approval.Status = ApprovalStatusRejected
+				if decision == "approve" {
+					approval.Status = ApprovalStatusApproved
+				}
+				approval.DecidedBy = "@" + request.UserName
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.WithError(err).Error("Failed to store approval decision")
+		http.Error(w, "unable to store decision", http.StatusInternalServerError)
+		return
+	}
+	if approval == nil {
+		writeApprovalResponse(w, "This scaling action is no longer waiting for approval.")
+		return
+	}
+
+	log.Infof("Vertical scaling of DB instance (%s) to (%s) %sd by @%s", approval.Action.DBInstanceIdentifier, approval.Action.NewClass, decision, request.UserName)
+	writeApprovalResponse(w, fmt.Sprintf("Vertical scaling of DB instance (%s) from (%s) to (%s) was %sd by @%s.", approval.Action.DBInstanceIdentifier, approval.Action.CurrentClass, approval.Action.NewClass, decision, request.UserName))
+}
+
+func writeApprovalResponse(w http.ResponseWriter, message string) {
+	response := model.PostActionIntegrationResponse{Update: &model.Post{Message: message}}
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.WithError(err).Error("Failed to write approval response")
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// runDaemon keeps polling the SQS queue and executing deferred scaling actions until the process is terminated.
+func runDaemon() error {
+	// The daemon keeps deferred actions, approvals and the scaling history across restarts, which a file in the
+	// temporary directory does not survive.
+	if os.Getenv("StateFile") == "" {
+		return errors.New("Environment variable StateFile must be set in daemon mode")
+	}
+
+	interval := time.Minute
+	if os.Getenv("DaemonPollInterval") != "" {
+		var err error
+		interval, err = time.ParseDuration(os.Getenv("DaemonPollInterval"))
+		if err != nil {
+			return errors.Wrap(err, "failed to parse DaemonPollInterval")
+		}
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+
+	metricsServer := startMetricsServer()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		err := metricsServer.Shutdown(ctx)
+		if err != nil {
+			log.WithError(err).Error("Failed to shut down metrics server")
+		}
+	}()
+
+	if isApprovalEnabled() {
+		server := startApprovalServer()
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			err := server.Shutdown(ctx)
+			if err != nil {
+				log.WithError(err).Error("Failed to shut down approval server")
+			}
+		}()
+	}
+
+	// The scheduled jobs can take minutes for a large fleet, so they run on their own and do not delay the alarms.
+	done := make(chan struct{})
+	var jobs sync.WaitGroup
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		runScheduledJobs(done, interval)
+	}()
+	defer jobs.Wait()
+	defer close(done)
+
+	log.Infof("Starting vertical scaling daemon with poll interval %s", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		runScalingCycle()
+		err := flushTraces()
+		if err != nil {
+			log.WithError(err).Error("Failed to export traces")
+		}
+
+		select {
+		case sig := <-stop:
+			log.Infof("Received signal (%s), stopping vertical scaling daemon", sig)
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// runScheduledJobs runs the scheduled fleet report and capacity forecast when they are due, checking every interval
+// until done is closed.
+func runScheduledJobs(done <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := runScheduledReport()
+		if err != nil {
+			log.WithError(err).Error("Failed to run scheduled fleet report")
+		}
+		err = runScheduledForecast()
+		if err != nil {
+			log.WithError(err).Error("Failed to run scheduled capacity forecast")
+		}
+
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// SpooledNotification is used to store a notification request that could not be delivered, so that it is retried by
+// the next run of the tool.
+type SpooledNotification struct {
+	URL          string            `json:"url"`
+	Body         string            `json:"body"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	Attempts     int               `json:"attempts"`
+	FirstFailure time.Time         `json:"firstFailure"`
+	LastError    string            `json:"lastError"`
+}
+
+// deliveryError is returned when a notification request fails. Retryable errors are the network errors, the 5xx
+// responses and the 429 responses.
+type deliveryError struct {
+	message   string
+	retryable bool
+}
+
+func (e *deliveryError) Error() string {
+	return e.message
+}
+
+func getWebhookTimeout() (time.Duration, error) {
+	if os.Getenv("WebhookTimeout") == "" {
+		return 10 * time.Second, nil
+	}
+	timeout, err := time.ParseDuration(os.Getenv("WebhookTimeout"))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to parse WebhookTimeout")
+	}
+	return timeout, nil
+}
+
+func getWebhookMaxRetries() (int, error) {
+	if os.Getenv("WebhookMaxRetries") == "" {
+		return 3, nil
+	}
+	retries, err := strconv.Atoi(os.Getenv("WebhookMaxRetries"))
+	if err != nil || retries < 0 {
+		return 0, errors.Errorf("WebhookMaxRetries (%s) is not a non-negative integer", os.Getenv("WebhookMaxRetries"))
+	}
+	return retries, nil
+}
+
+func getNotificationSpoolMaxAge() (time.Duration, error) {
+	if os.Getenv("NotificationSpoolMaxAge") == "" {
+		return 24 * time.Hour, nil
+	}
+	maxAge, err := time.ParseDuration(os.Getenv("NotificationSpoolMaxAge"))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to parse NotificationSpoolMaxAge")
+	}
+	return maxAge, nil
+}
+
+// attemptDelivery posts the body once and checks the response status.
+func attemptDelivery(client *http.Client, url string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return &deliveryError{message: fmt.Sprintf("failed to create HTTP request: %s", err)}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return &deliveryError{message: fmt.Sprintf("failed to send HTTP request: %s", err), retryable: true}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	return &deliveryError{
+		message:   fmt.Sprintf("request responded with status (%s)", resp.Status),
+		retryable: resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests,
+	}
+}
+
+// retryBudget is the time the delivery retries can still spend sleeping in the current scaling cycle, so that an
+// unreachable notifier does not hold up the handling of the alarms.
+var retryBudget = struct {
+	sync.Mutex
+	initialized bool
+	remaining   time.Duration
+}{}
+
+func getWebhookRetryBudget() (time.Duration, error) {
+	if os.Getenv("WebhookRetryBudget") == "" {
+		return 30 * time.Second, nil
+	}
+	budget, err := time.ParseDuration(os.Getenv("WebhookRetryBudget"))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to parse WebhookRetryBudget")
+	}
+	return budget, nil
+}
+
+// resetRetryBudget starts a new scaling cycle, which gets the full WebhookRetryBudget.
+func resetRetryBudget() {
+	retryBudget.Lock()
+	defer retryBudget.Unlock()
+	retryBudget.initialized = false
+}
+
+// takeRetryBudget takes the backoff from the retry budget of the cycle and returns false when the budget is spent.
+func takeRetryBudget(backoff time.Duration) (bool, error) {
+	retryBudget.Lock()
+	defer retryBudget.Unlock()
+	if !retryBudget.initialized {
+		budget, err := getWebhookRetryBudget()
+		if err != nil {
+			return false, err
+		}
+		retryBudget.remaining = budget
+		retryBudget.initialized = true
+	}
+	if backoff > retryBudget.remaining {
+		return false, nil
+	}
+	retryBudget.remaining -= backoff
+	return true, nil
+}
+
+// deliverWithRetries posts the body, retrying the retryable failures with exponential backoff starting at one second
+// while the retry budget of the cycle lasts. Without retry the body is posted once.
+func deliverWithRetries(url string, body []byte, headers map[string]string, retry bool) error {
+	timeout, err := getWebhookTimeout()
+	if err != nil {
+		return err
+	}
+	retries, err := getWebhookMaxRetries()
+	if err != nil {
+		return err
+	}
+	if !retry {
+		retries = 0
+	}
+
+	client := &http.Client{Timeout: timeout}
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		err = attemptDelivery(client, url, body, headers)
+		if err == nil || !err.(*deliveryError).retryable || attempt == retries {
+			return err
+		}
+		ok, budgetErr := takeRetryBudget(backoff)
+		if budgetErr != nil {
+			return budgetErr
+		}
+		if !ok {
+			log.WithError(err).Warn("Notification delivery failed and the WebhookRetryBudget of the cycle is spent, not retrying")
+			return err
+		}
+		log.WithError(err).Warnf("Notification delivery failed, retrying in %s (attempt %d of %d)", backoff, attempt+1, retries)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// deliver posts the notification request. When it still fails with a retryable error after the retries, it is
+// spooled in the state file to be retried by the next run. Without retry a failed request is spooled right away.
+func deliver(url string, body []byte, headers map[string]string, retry bool) error {
+	err := deliverWithRetries(url, body, headers, retry)
+	if err == nil {
+		return nil
+	}
+	delivery, ok := err.(*deliveryError)
+	if !ok || !delivery.retryable {
+		return err
+	}
+
+	spoolErr := spoolNotification(SpooledNotification{
+		URL:          url,
+		Body:         string(body),
+		Headers:      headers,
+		Attempts:     1,
+		FirstFailure: time.Now().UTC(),
+		LastError:    err.Error(),
+	})
+	if spoolErr != nil {
+		return errors.Wrapf(spoolErr, "failed to spool undelivered notification (%s)", err)
+	}
+	return errors.Wrap(err, "notification was spooled for the next run")
+}
+
+func spoolNotification(notification SpooledNotification) error {
+	return updateState(func(state *State) error {
+		state.UndeliveredNotifications = append(state.UndeliveredNotifications, notification)
+		return nil
+	})
+}
+
+// retrySpooledNotifications retries the delivery of the spooled notifications once each, without backoff. The ones
+// older than NotificationSpoolMaxAge or failing with a permanent error are dropped.
+func retrySpooledNotifications() error {
+	maxAge, err := getNotificationSpoolMaxAge()
+	if err != nil {
+		return err
+	}
+	state, err := loadState()
+	if err != nil {
+		return err
+	}
+	if len(state.UndeliveredNotifications) == 0 {
+		return nil
+	}
+
+	var remaining []SpooledNotification
+	for _, notification := range state.UndeliveredNotifications {
+		err = deliverWithRetries(notification.URL, []byte(notification.Body), notification.Headers, false)
+		if err == nil {
+			log.Infof("Spooled notification first failed at %s was delivered", notification.FirstFailure.Format(time.RFC3339))
+			continue
+		}
+
+		delivery, ok := err.(*deliveryError)
+		if !ok {
+			return err
+		}
+		notification.Attempts++
+		notification.LastError = err.Error()
+		switch {
+		case !delivery.retryable:
+			log.WithError(err).Errorf("Dropping spooled notification first failed at %s, the error is permanent", notification.FirstFailure.Format(time.RFC3339))
+		case time.Since(notification.FirstFailure) > maxAge:
+			log.WithError(err).Errorf("Dropping spooled notification first failed at %s after %d attempts", notification.FirstFailure.Format(time.RFC3339), notification.Attempts)
+		default:
+			remaining = append(remaining, notification)
+		}
+	}
+
+	// The notifications are only appended by the other runs, so the ones spooled while retrying follow the retried ones.
+	return updateState(func(current *State) error {
+		if len(current.UndeliveredNotifications) > len(state.UndeliveredNotifications) {
+			remaining = append(remaining, current.UndeliveredNotifications[len(state.UndeliveredNotifications):]...)
+		}
+		current.UndeliveredNotifications = remaining
+		return nil
+	})
+}
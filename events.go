@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/pkg/errors"
+)
+
+// ScalingEventSource is the source of the EventBridge events of the scaling actions.
+const ScalingEventSource = "mattermost.db-vertical-scaling"
+
+// ScalingEventDetailType is the detail type of the EventBridge events of the scaling actions.
+const ScalingEventDetailType = "DB Vertical Scaling Action"
+
+// Triggers of a scaling action.
+const (
+	ScalingTriggerAlarm             = "alarm"
+	ScalingTriggerMaintenanceWindow = "maintenance-window"
+	ScalingTriggerApproval          = "approval"
+	ScalingTriggerMigration         = "migration"
+	ScalingTriggerForecast          = "forecast"
+)
+
+// ScalingActionRecord is used to store the record of an executed scaling action published to other teams' automation.
+type ScalingActionRecord struct {
+	CorrelationID        string    `json:"correlationId"`
+	Environment          string    `json:"environment"`
+	DBInstanceIdentifier string    `json:"dbInstanceIdentifier"`
+	DBClusterIdentifier  string    `json:"dbClusterIdentifier"`
+	IsClusterWriter      bool      `json:"isClusterWriter"`
+	FromClass            string    `json:"fromClass"`
+	ToClass              string    `json:"toClass"`
+	ToClassIndex         int       `json:"toClassIndex"`
+	Trigger              string    `json:"trigger"`
+	Time                 time.Time `json:"time"`
+}
+
+// newScalingActionRecord returns the record of the scaling of the DB instance to the new class.
+func (d *DBInstance) newScalingActionRecord(newClass, trigger string) ScalingActionRecord {
+	return ScalingActionRecord{
+		CorrelationID:        d.CorrelationID,
+		Environment:          os.Getenv("Environment"),
+		DBInstanceIdentifier: d.DBInstanceIdentifier,
+		DBClusterIdentifier:  d.DBClusterIdentifier,
+		IsClusterWriter:      d.IsClusterWriter,
+		FromClass:            d.DBInstanceClass,
+		ToClass:              newClass,
+		ToClassIndex:         getClassIndex(newClass),
+		Trigger:              trigger,
+		Time:                 time.Now().UTC(),
+	}
+}
+
+// getClassIndex returns the index of the class in its ladder, or -1 when the class is in neither ladder.
+func getClassIndex(class string) int {
+	for _, ladder := range [][]string{DBInstanceClasses, DBInstanceGravitonClasses} {
+		for i, ladderClass := range ladder {
+			if ladderClass == class {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// publishScalingAction records the scaling action in the scaling history of the state file and publishes it as the
+// ScalingActions and CurrentClassIndex Cloudwatch metrics when ScalingMetricsNamespace is set, and as an EventBridge
+// event on ScalingEventBusName when it is set. Failures are returned but do not affect the scaling, which has already
+// happened.
+func (d *DBInstance) publishScalingAction(newClass, trigger string) error {
+	record := d.newScalingActionRecord(newClass, trigger)
+	err := appendScalingHistory(record)
+	if err != nil {
+		d.logger().WithError(err).Error("failed to record scaling action in the scaling history")
+	}
+
+	if os.Getenv("ScalingMetricsNamespace") == "" && os.Getenv("ScalingEventBusName") == "" {
+		return nil
+	}
+	clients, err := getAWSClients()
+	if err != nil {
+		return errors.Wrap(err, "failed to initiate AWS Clients")
+	}
+
+	if os.Getenv("ScalingMetricsNamespace") != "" {
+		_, span := startSpan(d.Context, "cloudwatch.PutMetricData")
+		err = putScalingMetrics(clients.CloudWatch, d.scalingGroupDimension(), d.scalingGroup(), record)
+		endSpan(span, err)
+		if err != nil {
+			return err
+		}
+	}
+
+	if os.Getenv("ScalingEventBusName") != "" {
+		_, span := startSpan(d.Context, "eventbridge.PutEvents")
+		err = putScalingEvent(clients.EventBridge, record)
+		endSpan(span, err)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func putScalingMetrics(client *cloudwatch.CloudWatch, dimension, scalingGroup string, record ScalingActionRecord) error {
+	dimensions := []*cloudwatch.Dimension{
+		{Name: aws.String(dimension), Value: aws.String(scalingGroup)},
+		{Name: aws.String("Environment"), Value: aws.String(record.Environment)},
+	}
+	metricData := []*cloudwatch.MetricDatum{
+		{
+			MetricName: aws.String("ScalingActions"),
+			Dimensions: dimensions,
+			Timestamp:  aws.Time(record.Time),
+			Unit:       aws.String(cloudwatch.StandardUnitCount),
+			Value:      aws.Float64(1),
+		},
+	}
+	if record.ToClassIndex >= 0 {
+		metricData = append(metricData, &cloudwatch.MetricDatum{
+			MetricName: aws.String("CurrentClassIndex"),
+			Dimensions: dimensions,
+			Timestamp:  aws.Time(record.Time),
+			Unit:       aws.String(cloudwatch.StandardUnitNone),
+			Value:      aws.Float64(float64(record.ToClassIndex)),
+		})
+	}
+
+	_, err := client.PutMetricData(&cloudwatch.PutMetricDataInput{
+		Namespace:  aws.String(os.Getenv("ScalingMetricsNamespace")),
+		MetricData: metricData,
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to put scaling Cloudwatch metrics")
+	}
+	return nil
+}
+
+func putScalingEvent(client *eventbridge.EventBridge, record ScalingActionRecord) error {
+	detail, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "unable to encode scaling event")
+	}
+
+	output, err := client.PutEvents(&eventbridge.PutEventsInput{
+		Entries: []*eventbridge.PutEventsRequestEntry{
+			{
+				EventBusName: aws.String(os.Getenv("ScalingEventBusName")),
+				Source:       aws.String(ScalingEventSource),
+				DetailType:   aws.String(ScalingEventDetailType),
+				Detail:       aws.String(string(detail)),
+				Time:         aws.Time(record.Time),
+			},
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to put scaling EventBridge event")
+	}
+	if aws.Int64Value(output.FailedEntryCount) > 0 {
+		return errors.Errorf("EventBridge rejected the scaling event: %s", aws.StringValue(output.Entries[0].ErrorMessage))
+	}
+	return nil
+}
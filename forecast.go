@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// ForecastAlarmName is the alarm name of the pending actions scheduled by the forecast, in place of the Cloudwatch
+// alarm of the reactive scaling.
+const ForecastAlarmName = "headroom-forecast"
+
+// ForecastMetricPeriod is the period (seconds) of the datapoints the trends are fitted to.
+const ForecastMetricPeriod = 3600
+
+// ForecastSettings are used to configure the capacity headroom forecast.
+type ForecastSettings struct {
+	Lookback                      time.Duration
+	Horizon                       time.Duration
+	Model                         string
+	MemoryHeadroomPercentage      float64
+	ConnectionsHeadroomPercentage float64
+	HoltAlpha                     float64
+	HoltBeta                      float64
+}
+
+// HeadroomForecast is used to store the projected headroom of a DB instance at the end of the forecast horizon.
+type HeadroomForecast struct {
+	ProjectedFreeableMemory       float64
+	ProjectedConnections          float64
+	MemoryHeadroomPercentage      float64
+	ConnectionsHeadroomPercentage float64
+}
+
+// metricPoint is a datapoint of a metric, with its time in seconds.
+type metricPoint struct {
+	time  float64
+	value float64
+}
+
+func getForecastSettings() (ForecastSettings, error) {
+	var settings ForecastSettings
+	var err error
+	settings.Lookback, err = getDurationEnv("ForecastLookback", 21*24*time.Hour)
+	if err != nil {
+		return settings, err
+	}
+	if settings.Lookback < 14*24*time.Hour || settings.Lookback > 28*24*time.Hour {
+		return settings, errors.Errorf("ForecastLookback (%s) must be between two and four weeks", settings.Lookback)
+	}
+	settings.Horizon, err = getDurationEnv("ForecastHorizon", 14*24*time.Hour)
+	if err != nil {
+		return settings, err
+	}
+	settings.Model = "linear"
+	if os.Getenv("ForecastModel") != "" {
+		settings.Model = os.Getenv("ForecastModel")
+	}
+	if settings.Model != "linear" && settings.Model != "holt" {
+		return settings, errors.Errorf("unsupported ForecastModel (%s), supported models are linear and holt", settings.Model)
+	}
+	settings.MemoryHeadroomPercentage, err = getFloatEnv("ForecastMemoryHeadroomPercentage", 15)
+	if err != nil {
+		return settings, err
+	}
+	settings.ConnectionsHeadroomPercentage, err = getFloatEnv("ForecastConnectionsHeadroomPercentage", 15)
+	if err != nil {
+		return settings, err
+	}
+	settings.HoltAlpha, err = getFloatEnv("ForecastHoltAlpha", 0.3)
+	if err != nil {
+		return settings, err
+	}
+	settings.HoltBeta, err = getFloatEnv("ForecastHoltBeta", 0.1)
+	if err != nil {
+		return settings, err
+	}
+	return settings, nil
+}
+
+// getForecastMetrics returns the hourly minimum FreeableMemory and maximum DatabaseConnections of the DB instance
+// over the lookback, oldest first.
+func getForecastMetrics(client *cloudwatch.CloudWatch, dbInstanceIdentifier string, lookback time.Duration) ([]metricPoint, []metricPoint, error) {
+	query := func(id, metricName, stat string) *cloudwatch.MetricDataQuery {
+		return &cloudwatch.MetricDataQuery{
+			Id: aws.String(id),
+			MetricStat: &cloudwatch.MetricStat{
+				Metric: &cloudwatch.Metric{
+					Namespace:  aws.String("AWS/RDS"),
+					MetricName: aws.String(metricName),
+					Dimensions: []*cloudwatch.Dimension{{Name: aws.String("DBInstanceIdentifier"), Value: aws.String(dbInstanceIdentifier)}},
+				},
+				Period: aws.Int64(ForecastMetricPeriod),
+				Stat:   aws.String(stat),
+			},
+		}
+	}
+
+	end := time.Now().UTC().Truncate(time.Hour)
+	input := &cloudwatch.GetMetricDataInput{
+		MetricDataQueries: []*cloudwatch.MetricDataQuery{
+			query("memory", "FreeableMemory", cloudwatch.StatisticMinimum),
+			query("connections", "DatabaseConnections", cloudwatch.StatisticMaximum),
+		},
+		StartTime: aws.Time(end.Add(-lookback)),
+		EndTime:   aws.Time(end),
+		ScanBy:    aws.String(cloudwatch.ScanByTimestampAscending),
+	}
+
+	series := make(map[string][]metricPoint)
+	err := client.GetMetricDataPages(input, func(page *cloudwatch.GetMetricDataOutput, lastPage bool) bool {
+		for _, result := range page.MetricDataResults {
+			id := aws.StringValue(result.Id)
+			for i, timestamp := range result.Timestamps {
+				series[id] = append(series[id], metricPoint{time: float64(aws.TimeValue(timestamp).Unix()), value: aws.Float64Value(result.Values[i])})
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "unable to get DB instance (%s) metric data", dbInstanceIdentifier)
+	}
+	return series["memory"], series["connections"], nil
+}
+
+// fitLinearTrend returns the least squares line of the datapoints, as the slope per second and the intercept. The
+// times are centered on the first datapoint to keep the sums precise.
+func fitLinearTrend(points []metricPoint) (float64, float64) {
+	n := float64(len(points))
+	origin := points[0].time
+	var sumTime, sumValue, sumTimeValue, sumTimeSquare float64
+	for _, point := range points {
+		t := point.time - origin
+		sumTime += t
+		sumValue += point.value
+		sumTimeValue += t * point.value
+		sumTimeSquare += t * t
+	}
+	denominator := n*sumTimeSquare - sumTime*sumTime
+	if denominator == 0 {
+		return 0, sumValue / n
+	}
+	slope := (n*sumTimeValue - sumTime*sumValue) / denominator
+	return slope, (sumValue-slope*sumTime)/n - slope*origin
+}
+
+// holtForecast returns the value projected steps periods after the last datapoint with Holt's linear trend method
+// (double exponential smoothing), which weights the recent datapoints more than a linear fit.
+func holtForecast(points []metricPoint, alpha, beta, steps float64) float64 {
+	level := points[0].value
+	trend := 0.0
+	if len(points) > 1 {
+		trend = points[1].value - points[0].value
+	}
+	for _, point := range points[1:] {
+		previousLevel := level
+		level = alpha*point.value + (1-alpha)*(level+trend)
+		trend = beta*(level-previousLevel) + (1-beta)*trend
+	}
+	return level + trend*steps
+}
+
+// projectMetric returns the value of the metric projected at the time with the forecast model.
+func projectMetric(points []metricPoint, at time.Time, settings ForecastSettings) float64 {
+	if settings.Model == "holt" {
+		steps := (float64(at.Unix()) - points[len(points)-1].time) / ForecastMetricPeriod
+		return holtForecast(points, settings.HoltAlpha, settings.HoltBeta, steps)
+	}
+	slope, intercept := fitLinearTrend(points)
+	return slope*float64(at.Unix()) + intercept
+}
+
+// forecastHeadroom returns the memory and connections headroom of the DB instance projected at the end of the forecast
+// horizon, or nil when there are not enough datapoints, which is less than half the lookback.
+func (d *DBInstance) forecastHeadroom(RDSClient *rds.RDS, cloudwatchClient *cloudwatch.CloudWatch, settings ForecastSettings) (*HeadroomForecast, error) {
+	_, span := startSpan(d.Context, "cloudwatch.GetMetricData", "db.instance", d.DBInstanceIdentifier)
+	memory, connections, err := getForecastMetrics(cloudwatchClient, d.DBInstanceIdentifier, settings.Lookback)
+	endSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	minDatapoints := int(settings.Lookback.Seconds() / ForecastMetricPeriod / 2)
+	if len(memory) < minDatapoints || len(connections) < minDatapoints {
+		d.stepLogger("forecastHeadroom").Infof("DB instance (%s) has %d memory and %d connections datapoints, %d needed. Skipping forecast", d.DBInstanceIdentifier, len(memory), len(connections), minDatapoints)
+		return nil, nil
+	}
+
+	maxConnectionsParameter, err := getMaxConnectionsParameter(RDSClient, d.DBInstanceIdentifier)
+	if err != nil {
+		return nil, err
+	}
+	spec, err := getDBInstanceClassSpec(d.DBInstanceClass, maxConnectionsParameter)
+	if err != nil {
+		return nil, err
+	}
+
+	at := time.Now().UTC().Add(settings.Horizon)
+	forecast := &HeadroomForecast{
+		ProjectedFreeableMemory: math.Max(projectMetric(memory, at, settings), 0),
+		ProjectedConnections:    math.Max(projectMetric(connections, at, settings), 0),
+	}
+	forecast.MemoryHeadroomPercentage = forecast.ProjectedFreeableMemory / spec.Memory * 100
+	forecast.ConnectionsHeadroomPercentage = (spec.MaxConnections - forecast.ProjectedConnections) / spec.MaxConnections * 100
+	return forecast, nil
+}
+
+// getForecastReason returns why the DB instance needs to be scaled up, or an empty string when the projected headroom
+// is above the thresholds.
+func (f *HeadroomForecast) getForecastReason(settings ForecastSettings) string {
+	if f.MemoryHeadroomPercentage < settings.MemoryHeadroomPercentage {
+		return fmt.Sprintf("Freeable memory is projected at %.1f%% of the class memory in %s, below %.1f%%", f.MemoryHeadroomPercentage, settings.Horizon, settings.MemoryHeadroomPercentage)
+	}
+	if f.ConnectionsHeadroomPercentage < settings.ConnectionsHeadroomPercentage {
+		return fmt.Sprintf("Connections headroom is projected at %.1f%% of the max connections in %s, below %.1f%%", f.ConnectionsHeadroomPercentage, settings.Horizon, settings.ConnectionsHeadroomPercentage)
+	}
+	return ""
+}
+
+// forecastDBInstance forecasts the headroom of the DB instance and schedules a scale-up in its next maintenance window
+// when the projected headroom is below a threshold. The scheduled action goes through the same checks as the deferred
+// actions when it is executed, including the approval.
+func forecastDBInstance(ctx context.Context, clients *AWSClients, dbInstanceIdentifier string, settings ForecastSettings, dryRun bool) error {
+	dbInstance := DBInstance{
+		DBInstanceIdentifier: dbInstanceIdentifier,
+		CorrelationID:        fmt.Sprintf("forecast-%s-%s", dbInstanceIdentifier, time.Now().UTC().Format("20060102")),
+		Context:              ctx,
+	}
+	dbInstance.addLogFields(log.Fields{"alarm_name": ForecastAlarmName})
+
+	err := dbInstance.getDatabaseInfo(clients.RDS)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to obtain DB instance (%s) information", dbInstance.DBInstanceIdentifier)
+	}
+	dbInstance.addLogFields(log.Fields{"cluster": dbInstance.DBClusterIdentifier})
+	if dbInstance.isServerless() || !dbInstance.getSetDBInstanceClass() {
+		dbInstance.logger().Infof("DB instance (%s) class (%s) is not forecasted", dbInstance.DBInstanceIdentifier, dbInstance.DBInstanceClass)
+		return nil
+	}
+
+	forecast, err := dbInstance.forecastHeadroom(clients.RDS, clients.CloudWatch, settings)
+	if err != nil || forecast == nil {
+		return err
+	}
+	dbInstance.logger().Infof("DB instance (%s) projected memory headroom %.1f%% and connections headroom %.1f%% in %s", dbInstance.DBInstanceIdentifier, forecast.MemoryHeadroomPercentage, forecast.ConnectionsHeadroomPercentage, settings.Horizon)
+	reason := forecast.getForecastReason(settings)
+	if reason == "" {
+		return nil
+	}
+
+	newClass, err := dbInstance.getNewClassType()
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get DB instance (%s) new class type", dbInstance.DBInstanceIdentifier)
+	}
+	newClass, err = dbInstance.migrateClassFamily(clients.RDS, newClass)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to migrate DB instance (%s) new class to Graviton", dbInstance.DBInstanceIdentifier)
+	}
+	orderableClass, err := dbInstance.getOrderableClass(clients.RDS, newClass)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to validate DB instance (%s) new class", dbInstance.DBInstanceIdentifier)
+	}
+	blocked := ""
+	if orderableClass == "" {
+		blocked = dbInstance.notOrderableReason(newClass)
+	} else {
+		newClass = orderableClass
+		blocked, err = dbInstance.checkGuardrails(clients.RDS, newClass)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to check DB instance (%s) scaling guardrails", dbInstance.DBInstanceIdentifier)
+		}
+	}
+	dbInstance.addLogFields(log.Fields{"target_class": newClass})
+
+	if dryRun {
+		dbInstance.logger().Infof("%s. Dry run, not scheduling the scale-up of DB instance (%s) to (%s)", reason, dbInstance.DBInstanceIdentifier, newClass)
+		return nil
+	}
+	if blocked != "" {
+		dbInstance.logger().Warnf("%s. %s", reason, blocked)
+		return dbInstance.sendMattermostBlockedNotification(newClass, fmt.Sprintf("%s. %s", reason, blocked))
+	}
+
+	window := dbInstance.getMaintenanceWindow()
+	if window == "" {
+		return errors.Errorf("DB instance (%s) has no maintenance window configured or set", dbInstance.DBInstanceIdentifier)
+	}
+	start, end, err := nextMaintenanceWindow(window, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	added, err := dbInstance.addPendingAction(newClass, ForecastAlarmName, window, start, end)
+	if err != nil || !added {
+		return err
+	}
+
+	dbInstance.logger().Infof("%s. DB instance (%s) scale-up to (%s) scheduled in the maintenance window starting at %s", reason, dbInstance.DBInstanceIdentifier, newClass, start.Format(time.RFC3339))
+	err = dbInstance.sendMattermostNotification(newClass, fmt.Sprintf("%s. Scale-up scheduled in the maintenance window starting at %s", reason, start.Format(time.RFC3339)))
+	if err != nil {
+		dbInstance.logger().WithError(err).Error("failed to send Mattermost notification")
+	}
+	return nil
+}
+
+// runForecast forecasts the headroom of every multitenant DB instance. A DB instance whose forecast fails does not
+// stop the others.
+func runForecast(dryRun bool) (err error) {
+	ctx, run := startSpan(context.Background(), "forecast", "dry_run", strconv.FormatBool(dryRun))
+	defer func() {
+		endSpan(run, err)
+	}()
+
+	settings, err := getForecastSettings()
+	if err != nil {
+		return err
+	}
+	clients, err := getAWSClients()
+	if err != nil {
+		return errors.Wrap(err, "Failed to initiate AWS Clients")
+	}
+	dbInstances, err := getMultitenantDBInstances(clients.RDS)
+	if err != nil {
+		return errors.Wrap(err, "Failed to get multitenant DB instances")
+	}
+
+	log.Infof("Forecasting the capacity headroom of %d multitenant DB instances with the %s model", len(dbInstances), settings.Model)
+	failures := 0
+	for _, dbInstance := range dbInstances {
+		identifier := aws.StringValue(dbInstance.DBInstanceIdentifier)
+		err = forecastDBInstance(ctx, clients, identifier, settings, dryRun)
+		if err != nil {
+			failures++
+			log.WithError(err).Errorf("Failed to forecast DB instance (%s) capacity headroom", identifier)
+		}
+	}
+	if failures > 0 {
+		return errors.Errorf("Failed to forecast the capacity headroom of %d DB instances", failures)
+	}
+	return nil
+}
+
+// runScheduledForecast runs the forecast when the previous one is at least ForecastInterval old.
+func runScheduledForecast() error {
+	if os.Getenv("ForecastInterval") == "" {
+		return nil
+	}
+	interval, err := time.ParseDuration(os.Getenv("ForecastInterval"))
+	if err != nil {
+		return errors.Wrap(err, "failed to parse ForecastInterval")
+	}
+	// The forecast is recorded first so that a failing DB instance is not forecasted on every poll.
+	due := false
+	err = updateState(func(state *State) error {
+		if time.Since(state.LastForecast) < interval {
+			return nil
+		}
+		due = true
+		state.LastForecast = time.Now().UTC()
+		return nil
+	})
+	if err != nil || !due {
+		return err
+	}
+	return runForecast(false)
+}
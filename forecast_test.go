@@ -0,0 +1,58 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFitLinearTrend(t *testing.T) {
+	tests := []struct {
+		name              string
+		points            []metricPoint
+		expectedSlope     float64
+		expectedIntercept float64
+	}{
+		{name: "single datapoint", points: []metricPoint{{time: 1000, value: 42}}, expectedSlope: 0, expectedIntercept: 42},
+		{name: "same time", points: []metricPoint{{time: 1000, value: 10}, {time: 1000, value: 20}}, expectedSlope: 0, expectedIntercept: 15},
+		{name: "flat", points: []metricPoint{{time: 0, value: 5}, {time: 300, value: 5}, {time: 600, value: 5}}, expectedSlope: 0, expectedIntercept: 5},
+		{name: "increasing", points: []metricPoint{{time: 100, value: 210}, {time: 200, value: 410}, {time: 300, value: 610}}, expectedSlope: 2, expectedIntercept: 10},
+		{name: "decreasing", points: []metricPoint{{time: 1700000000, value: 1000}, {time: 1700003600, value: 640}, {time: 1700007200, value: 280}}, expectedSlope: -0.1, expectedIntercept: 170001000},
+		{name: "noisy", points: []metricPoint{{time: 0, value: 1}, {time: 1, value: 3}, {time: 2, value: 2}, {time: 3, value: 4}}, expectedSlope: 0.8, expectedIntercept: 1.3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slope, intercept := fitLinearTrend(test.points)
+			if math.Abs(slope-test.expectedSlope) > 1e-9 || math.Abs(intercept-test.expectedIntercept) > 1e-6 {
+				t.Errorf("expected slope %v and intercept %v, got %v and %v", test.expectedSlope, test.expectedIntercept, slope, intercept)
+			}
+		})
+	}
+}
+
+func TestHoltForecast(t *testing.T) {
+	tests := []struct {
+		name     string
+		points   []metricPoint
+		alpha    float64
+		beta     float64
+		steps    float64
+		expected float64
+	}{
+		{name: "single datapoint", points: []metricPoint{{value: 42}}, alpha: 0.5, beta: 0.5, steps: 10, expected: 42},
+		{name: "flat", points: []metricPoint{{value: 5}, {value: 5}, {value: 5}}, alpha: 0.5, beta: 0.5, steps: 10, expected: 5},
+		{name: "linear", points: []metricPoint{{value: 10}, {value: 20}, {value: 30}, {value: 40}}, alpha: 0.5, beta: 0.5, steps: 2, expected: 60},
+		{name: "no steps", points: []metricPoint{{value: 10}, {value: 20}, {value: 30}, {value: 40}}, alpha: 0.3, beta: 0.1, steps: 0, expected: 40},
+		{name: "level only", points: []metricPoint{{value: 10}, {value: 20}, {value: 20}}, alpha: 1, beta: 0, steps: 1, expected: 30},
+		{name: "smoothed", points: []metricPoint{{value: 10}, {value: 20}, {value: 10}}, alpha: 0.5, beta: 0.5, steps: 1, expected: 25},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value := holtForecast(test.points, test.alpha, test.beta, test.steps)
+			if math.Abs(value-test.expected) > 1e-9 {
+				t.Errorf("expected %v, got %v", test.expected, value)
+			}
+		})
+	}
+}
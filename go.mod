@@ -3,9 +3,15 @@ module github.com/mattermost/cloud-db-factory-vertical-scaling
 go 1.14
 
 require (
-	github.com/aws/aws-sdk-go v1.32.11
+	github.com/aws/aws-sdk-go v1.44.0
 	github.com/mattermost/mattermost-server/v5 v5.24.2
 	github.com/pkg/errors v0.9.1
+	github.com/prometheus/client_golang v1.12.2
 	github.com/sirupsen/logrus v1.6.0
+	go.opentelemetry.io/otel v1.10.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.10.0
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.10.0
+	go.opentelemetry.io/otel/sdk v1.10.0
+	go.opentelemetry.io/otel/trace v1.10.0
 	golang.org/x/sys v0.0.0-20220722155257-8c9f86f7a55f // indirect
 )
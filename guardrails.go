@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/pkg/errors"
+)
+
+// HoursPerMonth is the average number of hours in a month used for the monthly cost estimations.
+const HoursPerMonth = 730
+
+// getHourlyPrice returns the hourly price of an instance class, applying the HourlyPrices overrides, which is a JSON
+// object mapping classes to prices, e.g. {"db.r5.large": 0.29}.
+func getHourlyPrice(class string) (float64, error) {
+	if os.Getenv("HourlyPrices") != "" {
+		var overrides map[string]float64
+		err := json.Unmarshal([]byte(os.Getenv("HourlyPrices")), &overrides)
+		if err != nil {
+			return 0, errors.Wrap(err, "unable to decode HourlyPrices")
+		}
+		if price, ok := overrides[class]; ok {
+			return price, nil
+		}
+	}
+
+	price, ok := DBInstanceClassHourlyPrice[class]
+	if !ok {
+		return 0, errors.Errorf("no hourly price found for class (%s)", class)
+	}
+	return price, nil
+}
+
+// instanceCount returns the number of instances billed for the scaled class, which is two for Multi-AZ standalone
+// DB instances because the standby is scaled too.
+func (d *DBInstance) instanceCount() float64 {
+	if d.MultiAZ {
+		return 2
+	}
+	return 1
+}
+
+// getClusterMonthlyCost returns the estimated monthly cost of all the instances of the DB cluster. Serverless v2
+// instances are estimated at the max capacity of the DB cluster. Standalone DB instances are estimated on their own,
+// counting the standby of Multi-AZ instances.
+func (d *DBInstance) getClusterMonthlyCost(client *rds.RDS) (float64, error) {
+	if d.isStandalone() {
+		price, err := getHourlyPrice(d.DBInstanceClass)
+		if err != nil {
+			return 0, err
+		}
+		return price * d.instanceCount() * HoursPerMonth, nil
+	}
+
+	databaseInstances, err := client.DescribeDBInstances(&rds.DescribeDBInstancesInput{
+		Filters: []*rds.Filter{{Name: aws.String("db-cluster-id"), Values: []*string{aws.String(d.DBClusterIdentifier)}}},
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to describe DB cluster instances")
+	}
+
+	var cost float64
+	for _, instance := range databaseInstances.DBInstances {
+		if aws.StringValue(instance.DBInstanceClass) == DBInstanceClassServerless && d.ServerlessV2 != nil {
+			price, err := getServerlessV2ACUHourlyPrice()
+			if err != nil {
+				return 0, err
+			}
+			cost += price * aws.Float64Value(d.ServerlessV2.MaxCapacity) * HoursPerMonth
+			continue
+		}
+		price, err := getHourlyPrice(aws.StringValue(instance.DBInstanceClass))
+		if err != nil {
+			return 0, err
+		}
+		cost += price * HoursPerMonth
+	}
+	return cost, nil
+}
+
+// getModifiedClass returns the current class of the DB instance whose class is changed by the scaling. A writer is
+// replaced by a reader upgraded to the new class, so the class of that reader is returned, or the new class when the
+// reader is already at least as large and is not modified.
+func (d *DBInstance) getModifiedClass(client *rds.RDS, newClass string) (string, error) {
+	if d.isStandalone() || !d.IsClusterWriter {
+		return d.DBInstanceClass, nil
+	}
+
+	clusterMembers, err := d.getDBClusterMembers(client)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get DB cluster members")
+	}
+	members, err := d.getClusterMemberStates(client)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get DB cluster members state")
+	}
+	reader := d.selectFailoverReader(clusterMembers, members)
+	if reader == "" {
+		return "", errors.Errorf("DB cluster (%s) has no reader to replace the writer", d.DBClusterIdentifier)
+	}
+
+	readerClass := members[reader].Class
+	readerMemory, err := getClassMemory(readerClass)
+	if err != nil {
+		return "", err
+	}
+	newMemory, err := getClassMemory(newClass)
+	if err != nil {
+		return "", err
+	}
+	if readerMemory > newMemory {
+		return newClass, nil
+	}
+	return readerClass, nil
+}
+
+// checkGuardrails returns the reason the scaling to the new class is blocked, or an empty string when it is allowed.
+// The scaling is blocked when the new class is larger than the max class of the policy or when the estimated monthly
+// cost of the DB cluster after the scaling exceeds the monthly budget. The cost change is estimated from the class of
+// the DB instance that is actually modified, see getModifiedClass.
+func (d *DBInstance) checkGuardrails(client *rds.RDS, newClass string) (string, error) {
+	if d.Policy.MaxClass != "" {
+		maxMemory, err := getClassMemory(d.Policy.MaxClass)
+		if err != nil {
+			return "", err
+		}
+		memory, err := getClassMemory(newClass)
+		if err != nil {
+			return "", err
+		}
+		if memory > maxMemory {
+			return fmt.Sprintf("Class (%s) exceeds the max class (%s)", newClass, d.Policy.MaxClass), nil
+		}
+	}
+
+	if d.Policy.MonthlyBudget > 0 {
+		currentCost, err := d.getClusterMonthlyCost(client)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to estimate DB cluster monthly cost")
+		}
+		modifiedClass, err := d.getModifiedClass(client, newClass)
+		if err != nil {
+			return "", err
+		}
+		currentPrice, err := getHourlyPrice(modifiedClass)
+		if err != nil {
+			return "", err
+		}
+		newPrice, err := getHourlyPrice(newClass)
+		if err != nil {
+			return "", err
+		}
+
+		newCost := currentCost + (newPrice-currentPrice)*d.instanceCount()*HoursPerMonth
+		d.stepLogger("checkGuardrails").Infof("Scaling group (%s) estimated monthly cost is $%.2f, $%.2f after scaling to (%s)", d.scalingGroup(), currentCost, newCost, newClass)
+		if newCost > d.Policy.MonthlyBudget {
+			return fmt.Sprintf("Estimated monthly cost $%.2f after scaling exceeds the monthly budget $%.2f", newCost, d.Policy.MonthlyBudget), nil
+		}
+	}
+	return "", nil
+}
+
+// checkServerlessV2Guardrails returns the reason the change to the new Serverless v2 capacity is blocked, or an empty
+// string when it is allowed. The max capacity is already capped by ServerlessV2MaxCapacity, so only the monthly budget
+// is checked, with the serverless instances estimated at the new max capacity.
+func (d *DBInstance) checkServerlessV2Guardrails(client *rds.RDS, capacity *ServerlessV2Capacity) (string, error) {
+	if d.Policy.MonthlyBudget <= 0 {
+		return "", nil
+	}
+	currentCost, err := d.getClusterMonthlyCost(client)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to estimate DB cluster monthly cost")
+	}
+	scaled := *d
+	scaled.ServerlessV2 = capacity
+	newCost, err := scaled.getClusterMonthlyCost(client)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to estimate DB cluster monthly cost")
+	}
+
+	d.stepLogger("checkServerlessV2Guardrails").Infof("Scaling group (%s) estimated monthly cost is $%.2f, $%.2f after scaling to (%s)", d.scalingGroup(), currentCost, newCost, capacity)
+	if newCost > d.Policy.MonthlyBudget {
+		return fmt.Sprintf("Estimated monthly cost $%.2f after scaling exceeds the monthly budget $%.2f", newCost, d.Policy.MonthlyBudget), nil
+	}
+	return "", nil
+}
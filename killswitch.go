@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/pkg/errors"
+)
+
+// ScalingDisabledTag is the DB cluster tag that disables automated scaling for the cluster when set to "disabled".
+const ScalingDisabledTag = "vertical-scaling"
+
+// BlackoutPeriod is used to store a calendar period during which automated scaling is not allowed.
+type BlackoutPeriod struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// getScalingSuppression checks the global kill switches and returns the reason automated scaling is suppressed,
+// or an empty string when scaling is allowed.
+func getScalingSuppression(client *ssm.SSM, now time.Time) (string, error) {
+	if os.Getenv("VerticalScalingDisabled") == "true" {
+		return "Vertical scaling is disabled by the VerticalScalingDisabled environment variable", nil
+	}
+
+	if os.Getenv("KillSwitchParameter") != "" {
+		parameterName := os.Getenv("KillSwitchParameter")
+		parameter, err := client.GetParameter(&ssm.GetParameterInput{Name: aws.String(parameterName)})
+		if err != nil {
+			return "", errors.Wrapf(err, "unable to get SSM parameter (%s)", parameterName)
+		}
+		value := strings.ToLower(strings.TrimSpace(aws.StringValue(parameter.Parameter.Value)))
+		if value == "disabled" || value == "true" {
+			return fmt.Sprintf("Vertical scaling is disabled by the SSM parameter (%s)", parameterName), nil
+		}
+	}
+
+	blackoutPeriods, err := getBlackoutPeriods()
+	if err != nil {
+		return "", err
+	}
+	for _, period := range blackoutPeriods {
+		if !now.Before(period.Start) && now.Before(period.End) {
+			return fmt.Sprintf("Vertical scaling is suspended during the blackout period %s - %s", period.Start.Format(time.RFC3339), period.End.Format(time.RFC3339)), nil
+		}
+	}
+
+	return "", nil
+}
+
+// MaxSQSVisibilityTimeout is the longest time SQS can hide a received message.
+const MaxSQSVisibilityTimeout = 12 * time.Hour
+
+// getSuppressionRetryTime returns when a scaling request suppressed at now is handled again: at the end of the current
+// blackout period, or after SuppressedScalingRetryInterval (default 1h) when the end of the suppression is unknown.
+func getSuppressionRetryTime(now time.Time) (time.Time, error) {
+	blackoutPeriods, err := getBlackoutPeriods()
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, period := range blackoutPeriods {
+		if !now.Before(period.Start) && now.Before(period.End) {
+			return period.End, nil
+		}
+	}
+
+	interval := time.Hour
+	if os.Getenv("SuppressedScalingRetryInterval") != "" {
+		interval, err = time.ParseDuration(os.Getenv("SuppressedScalingRetryInterval"))
+		if err != nil {
+			return time.Time{}, errors.Wrap(err, "failed to parse SuppressedScalingRetryInterval")
+		}
+	}
+	return now.Add(interval), nil
+}
+
+// getClusterScalingSuppression returns the reason automated scaling is suppressed for the DB cluster of the instance,
+// or for the instance itself when it is standalone, or an empty string when scaling is allowed.
+func (d *DBInstance) getClusterScalingSuppression(now time.Time) (string, error) {
+	if strings.ToLower(d.ClusterTags[ScalingDisabledTag]) == "disabled" {
+		return fmt.Sprintf("Vertical scaling is disabled by the %s=disabled tag on scaling group (%s)", ScalingDisabledTag, d.scalingGroup()), nil
+	}
+	return d.getCooldownSuppression(now)
+}
+
+// getBlackoutPeriods parses the BlackoutPeriods environment variable, which contains comma separated periods in
+// the RFC3339 start/end format, e.g. 2026-12-20T00:00:00Z/2027-01-04T00:00:00Z.
+func getBlackoutPeriods() ([]BlackoutPeriod, error) {
+	var blackoutPeriods []BlackoutPeriod
+	if os.Getenv("BlackoutPeriods") == "" {
+		return blackoutPeriods, nil
+	}
+
+	for _, period := range strings.Split(os.Getenv("BlackoutPeriods"), ",") {
+		boundaries := strings.Split(strings.TrimSpace(period), "/")
+		if len(boundaries) != 2 {
+			return nil, errors.Errorf("invalid blackout period (%s)", period)
+		}
+		start, err := time.Parse(time.RFC3339, boundaries[0])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid blackout period (%s) start", period)
+		}
+		end, err := time.Parse(time.RFC3339, boundaries[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid blackout period (%s) end", period)
+		}
+		if !end.After(start) {
+			return nil, errors.Errorf("blackout period (%s) ends before it starts", period)
+		}
+		blackoutPeriods = append(blackoutPeriods, BlackoutPeriod{Start: start, End: end})
+	}
+	return blackoutPeriods, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetBlackoutPeriods(t *testing.T) {
+	defer os.Unsetenv("BlackoutPeriods")
+
+	tests := []struct {
+		name     string
+		value    string
+		expected []BlackoutPeriod
+		wantErr  bool
+	}{
+		{name: "not set", value: ""},
+		{
+			name:  "single period",
+			value: "2026-12-20T00:00:00Z/2027-01-04T00:00:00Z",
+			expected: []BlackoutPeriod{
+				{Start: time.Date(2026, time.December, 20, 0, 0, 0, 0, time.UTC), End: time.Date(2027, time.January, 4, 0, 0, 0, 0, time.UTC)},
+			},
+		},
+		{
+			name:  "several periods with spaces",
+			value: "2026-11-26T00:00:00Z/2026-11-30T00:00:00Z, 2026-12-20T00:00:00Z/2027-01-04T00:00:00Z",
+			expected: []BlackoutPeriod{
+				{Start: time.Date(2026, time.November, 26, 0, 0, 0, 0, time.UTC), End: time.Date(2026, time.November, 30, 0, 0, 0, 0, time.UTC)},
+				{Start: time.Date(2026, time.December, 20, 0, 0, 0, 0, time.UTC), End: time.Date(2027, time.January, 4, 0, 0, 0, 0, time.UTC)},
+			},
+		},
+		{name: "missing end", value: "2026-12-20T00:00:00Z", wantErr: true},
+		{name: "invalid start", value: "2026-12-20/2027-01-04T00:00:00Z", wantErr: true},
+		{name: "invalid end", value: "2026-12-20T00:00:00Z/tomorrow", wantErr: true},
+		{name: "end before start", value: "2027-01-04T00:00:00Z/2026-12-20T00:00:00Z", wantErr: true},
+		{name: "empty period", value: "2026-12-20T00:00:00Z/2026-12-20T00:00:00Z", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			os.Setenv("BlackoutPeriods", test.value)
+			periods, err := getBlackoutPeriods()
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", periods)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(periods) != len(test.expected) || (len(periods) > 0 && !reflect.DeepEqual(periods, test.expected)) {
+				t.Errorf("expected %v, got %v", test.expected, periods)
+			}
+		})
+	}
+}
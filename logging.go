@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// configureLogging sets the log format and level. LogFormat=json writes one JSON object per line so that the fields
+// of the scaling runs can be queried in the log pipeline.
+func configureLogging() error {
+	switch os.Getenv("LogFormat") {
+	case "", "text":
+	case "json":
+		log.SetFormatter(&log.JSONFormatter{})
+	default:
+		return errors.Errorf("unsupported LogFormat (%s), supported formats are text and json", os.Getenv("LogFormat"))
+	}
+
+	if os.Getenv("LogLevel") != "" {
+		level, err := log.ParseLevel(os.Getenv("LogLevel"))
+		if err != nil {
+			return errors.Wrap(err, "failed to parse LogLevel")
+		}
+		log.SetLevel(level)
+	}
+	return nil
+}
+
+// getCorrelationID returns the SQS message ID, which identifies the scaling run in the logs and the notifications.
+func getCorrelationID(message *sqs.ReceiveMessageOutput) string {
+	return aws.StringValue(message.Messages[0].MessageId)
+}
+
+// logger returns the logger of the scaling run of the DB instance, with the fields identifying the run.
+func (d *DBInstance) logger() *log.Entry {
+	if d.Log == nil {
+		d.Log = log.WithFields(log.Fields{"correlation_id": d.CorrelationID, "instance": d.DBInstanceIdentifier})
+	}
+	return d.Log
+}
+
+// addLogFields adds the fields to the logger of the scaling run of the DB instance.
+func (d *DBInstance) addLogFields(fields log.Fields) {
+	d.Log = d.logger().WithFields(fields)
+}
+
+// stepLogger returns the logger of the scaling run of the DB instance for a step of the run.
+func (d *DBInstance) stepLogger(step string) *log.Entry {
+	return d.logger().WithField("step", step)
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"os"
 	"strconv"
@@ -12,10 +13,13 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
 	"github.com/aws/aws-sdk-go/service/rds"
 	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/ssm"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // DBInstanceClasses is used to store the available DB Instance Classes. The classes are specified with size order.
@@ -76,6 +80,57 @@ var DBInstanceGravitonClassMemory = map[string]string{
 	"db.r6g.24xlarge": "824633720832",
 }
 
+// DBInstanceClassHourlyPrice maps DB instance types, Intel and Graviton, with their on-demand hourly price (USD).
+// The prices are the Aurora PostgreSQL prices of us-east-1 and can be overridden with the HourlyPrices environment variable.
+var DBInstanceClassHourlyPrice = map[string]float64{
+	"db.t3.medium":    0.082,
+	"db.t3.large":     0.164,
+	"db.r5.large":     0.29,
+	"db.r5.xlarge":    0.58,
+	"db.r5.2xlarge":   1.16,
+	"db.r5.4xlarge":   2.32,
+	"db.r5.8xlarge":   4.64,
+	"db.r5.12xlarge":  6.96,
+	"db.r5.16xlarge":  9.28,
+	"db.r5.24xlarge":  13.92,
+	"db.t4g.small":    0.037,
+	"db.t4g.medium":   0.073,
+	"db.t4g.large":    0.146,
+	"db.r6g.large":    0.26,
+	"db.r6g.xlarge":   0.519,
+	"db.r6g.2xlarge":  1.038,
+	"db.r6g.4xlarge":  2.076,
+	"db.r6g.8xlarge":  4.152,
+	"db.r6g.12xlarge": 6.228,
+	"db.r6g.16xlarge": 8.304,
+	"db.r6g.24xlarge": 12.456,
+}
+
+// DBInstanceClassVCPU maps DB instance types, Intel and Graviton, with their number of vCPUs
+var DBInstanceClassVCPU = map[string]int{
+	"db.t3.medium":    2,
+	"db.t3.large":     2,
+	"db.r5.large":     2,
+	"db.r5.xlarge":    4,
+	"db.r5.2xlarge":   8,
+	"db.r5.4xlarge":   16,
+	"db.r5.8xlarge":   32,
+	"db.r5.12xlarge":  48,
+	"db.r5.16xlarge":  64,
+	"db.r5.24xlarge":  96,
+	"db.t4g.small":    2,
+	"db.t4g.medium":   2,
+	"db.t4g.large":    2,
+	"db.r6g.large":    2,
+	"db.r6g.xlarge":   4,
+	"db.r6g.2xlarge":  8,
+	"db.r6g.4xlarge":  16,
+	"db.r6g.8xlarge":  32,
+	"db.r6g.12xlarge": 48,
+	"db.r6g.16xlarge": 64,
+	"db.r6g.24xlarge": 96,
+}
+
 // SQSMessageBody is used to decode the SQS Message Body
 type SQSMessageBody struct {
 	Type             string `json:"type"`
@@ -128,18 +183,38 @@ type Dimensions struct {
 
 // DBInstance is used to store information about each DB Instance
 type DBInstance struct {
-	SizeIndex            int    `json:"sizeIndex"`
-	DBInstanceClass      string `json:"dbInstanceType"`
-	DBInstanceStatus     string `json:"dbInstanceStatus"`
-	DBInstanceIdentifier string `json:"dbInstanceIdentifier"`
-	DBClusterIdentifier  string `json:"dbClusterIdentifier"`
-	IsClusterWriter      bool   `json:"isClusterWriter"`
-	IsArm                bool   `json:"isArm"`
+	SizeIndex            int                   `json:"sizeIndex"`
+	DBInstanceClass      string                `json:"dbInstanceType"`
+	DBInstanceStatus     string                `json:"dbInstanceStatus"`
+	DBInstanceIdentifier string                `json:"dbInstanceIdentifier"`
+	DBClusterIdentifier  string                `json:"dbClusterIdentifier"`
+	IsClusterWriter      bool                  `json:"isClusterWriter"`
+	IsArm                bool                  `json:"isArm"`
+	MaintenanceWindow    string                `json:"maintenanceWindow"`
+	DBClusterArn         string                `json:"dbClusterArn"`
+	ClusterTags          map[string]string     `json:"clusterTags"`
+	Policy               ScalingPolicy         `json:"policy"`
+	ServerlessV2         *ServerlessV2Capacity `json:"serverlessV2"`
+	MultiAZ              bool                  `json:"multiAZ"`
+	CorrelationID        string                `json:"correlationId"`
+	Log                  *log.Entry            `json:"-"`
+	Context              context.Context       `json:"-"`
+	Thread               *NotificationThread   `json:"-"`
+	Engine               string                `json:"engine"`
+	EngineVersion        string                `json:"engineVersion"`
+	AvailabilityZone     string                `json:"availabilityZone"`
+	ModifiedZone         string                `json:"modifiedZone"`
 }
 
 func main() {
 
-	err := checkEnvVariables()
+	err := configureLogging()
+	if err != nil {
+		log.WithError(err).Error("Failed to configure logging")
+		return
+	}
+
+	err = checkEnvVariables()
 	if err != nil {
 		log.WithError(err).Error("Environment variables were not set")
 		err = sendMattermostErrorNotification(err, "The Database Factory vertical scaling failed.")
@@ -149,14 +224,165 @@ func main() {
 		return
 	}
 
+	err = configureNotifiers()
+	if err != nil {
+		log.WithError(err).Error("Failed to configure notifiers")
+		err = sendMattermostErrorNotification(err, "The Database Factory vertical scaling failed.")
+		if err != nil {
+			log.WithError(err).Error("Failed to send Mattermost error notification")
+		}
+		return
+	}
+
+	err = configureTracing()
+	if err != nil {
+		log.WithError(err).Error("Failed to configure tracing")
+		err = sendMattermostErrorNotification(err, "The Database Factory vertical scaling failed.")
+		if err != nil {
+			log.WithError(err).Error("Failed to send Mattermost error notification")
+		}
+		return
+	}
+
+	command := "scale"
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+
+	switch command {
+	case "scale":
+		if isApprovalEnabled() {
+			log.Error("ApprovalCallbackURL requires daemon mode, the approval endpoint only runs in the daemon")
+			err = sendMattermostErrorNotification(errors.New("ApprovalCallbackURL is set outside of daemon mode"), "The Database Factory vertical scaling failed.")
+			if err != nil {
+				log.WithError(err).Error("Failed to send Mattermost error notification")
+			}
+			return
+		}
+		runScalingCycle()
+	case "reconcile-alarms":
+		flags := flag.NewFlagSet(command, flag.ExitOnError)
+		fix := flags.Bool("fix", false, "Create the missing alarms and update the drifted ones instead of only reporting them")
+		_ = flags.Parse(os.Args[2:])
+		err = reconcileAlarms(*fix)
+		if err != nil {
+			log.WithError(err).Error("Failed to reconcile Cloudwatch alarms")
+			err = sendMattermostErrorNotification(err, "The Database Factory alarm reconciliation failed")
+			if err != nil {
+				log.WithError(err).Error("Failed to send Mattermost error notification")
+			}
+		}
+	case "migrate-family":
+		flags := flag.NewFlagSet(command, flag.ExitOnError)
+		instance := flags.String("instance", "", "Identifier of the DB instance to migrate to the Graviton equivalent of its class")
+		dryRun := flags.Bool("dry-run", false, "Only log the Graviton class the DB instance would be migrated to")
+		_ = flags.Parse(os.Args[2:])
+		err = migrateFamily(*instance, *dryRun)
+		if err != nil {
+			log.WithError(err).Error("Failed to migrate DB instance to Graviton")
+			err = sendMattermostErrorNotification(err, "The Database Factory migration to Graviton failed")
+			if err != nil {
+				log.WithError(err).Error("Failed to send Mattermost error notification")
+			}
+		}
+	case "report":
+		flags := flag.NewFlagSet(command, flag.ExitOnError)
+		period := flags.String("period", "daily", "Period of the report, daily or weekly")
+		output := flags.String("output", os.Getenv("ReportOutputDir"), "Directory the Markdown and CSV reports are written to")
+		post := flags.Bool("post", true, "Post the report with the notifiers")
+		_ = flags.Parse(os.Args[2:])
+		err = runFleetReport(*period, *output, *post)
+		if err != nil {
+			log.WithError(err).Error("Failed to run fleet report")
+			err = sendMattermostErrorNotification(err, "The Database Factory fleet report failed")
+			if err != nil {
+				log.WithError(err).Error("Failed to send Mattermost error notification")
+			}
+		}
+	case "forecast":
+		flags := flag.NewFlagSet(command, flag.ExitOnError)
+		dryRun := flags.Bool("dry-run", false, "Only log the projected headroom and the scale-ups that would be scheduled")
+		_ = flags.Parse(os.Args[2:])
+		err = runForecast(*dryRun)
+		if err != nil {
+			log.WithError(err).Error("Failed to forecast capacity headroom")
+			err = sendMattermostErrorNotification(err, "The Database Factory capacity forecast failed")
+			if err != nil {
+				log.WithError(err).Error("Failed to send Mattermost error notification")
+			}
+		}
+	case "daemon":
+		err = runDaemon()
+		if err != nil {
+			log.WithError(err).Error("Failed to run database factory vertical scaling daemon")
+			err = sendMattermostErrorNotification(err, "The Database Factory vertical scaling daemon failed")
+			if err != nil {
+				log.WithError(err).Error("Failed to send Mattermost error notification")
+			}
+		}
+	default:
+		log.Errorf("Unknown command (%s). Supported commands are scale, daemon, reconcile-alarms, migrate-family, report and forecast", command)
+		return
+	}
+
+	if command != "daemon" {
+		err = pushMetrics()
+		if err != nil {
+			log.WithError(err).Error("Failed to push metrics")
+		}
+		err = flushTraces()
+		if err != nil {
+			log.WithError(err).Error("Failed to export traces")
+		}
+	}
+}
+
+// runScalingCycle retries the undelivered notifications, handles a single SQS message, executes any deferred scaling
+// actions that are due and any scaling actions that were approved, and enables the alarm actions of the clusters whose
+// warmup period is over.
+func runScalingCycle() {
+	resetRetryBudget()
+	err := retrySpooledNotifications()
+	if err != nil {
+		log.WithError(err).Error("Failed to retry undelivered notifications")
+	}
+
 	err = verticalScaling()
 	if err != nil {
+		metrics.MessagesFailed.Inc()
 		log.WithError(err).Error("Failed to run database factory vertical scaling")
 		err = sendMattermostErrorNotification(err, "Τhe Database Factory vertical scaling failed")
 		if err != nil {
 			log.WithError(err).Error("Failed to send Mattermost error notification")
 		}
 	}
+
+	err = processPendingActions()
+	if err != nil {
+		log.WithError(err).Error("Failed to process deferred vertical scaling actions")
+		err = sendMattermostErrorNotification(err, "The Database Factory deferred vertical scaling failed")
+		if err != nil {
+			log.WithError(err).Error("Failed to send Mattermost error notification")
+		}
+	}
+
+	err = processPendingApprovals()
+	if err != nil {
+		log.WithError(err).Error("Failed to process vertical scaling approvals")
+		err = sendMattermostErrorNotification(err, "The Database Factory approved vertical scaling failed")
+		if err != nil {
+			log.WithError(err).Error("Failed to send Mattermost error notification")
+		}
+	}
+
+	err = processAlarmSuppressions()
+	if err != nil {
+		log.WithError(err).Error("Failed to enable Cloudwatch alarm actions after warmup")
+		err = sendMattermostErrorNotification(err, "The Database Factory failed to enable Cloudwatch alarm actions after warmup")
+		if err != nil {
+			log.WithError(err).Error("Failed to send Mattermost error notification")
+		}
+	}
 }
 
 func checkEnvVariables() error {
@@ -188,13 +414,17 @@ func checkEnvVariables() error {
 	return nil
 }
 
-func verticalScaling() error {
-	SQSClient, RDSClient, cloudwatchClient, err := getAWSClients()
+func verticalScaling() (err error) {
+	clients, err := getAWSClients()
 	if err != nil {
 		return errors.Wrap(err, "Failed to initiate AWS Clients")
 	}
+	SQSClient, RDSClient, cloudwatchClient := clients.SQS, clients.RDS, clients.CloudWatch
 
+	ctx, run := startSpan(context.Background(), "verticalScaling")
+	_, span := startSpan(ctx, "sqs.ReceiveMessage")
 	message, err := getSQSMessage(SQSClient)
+	endSpan(span, err)
 	if err != nil {
 		return errors.Wrap(err, "Failed to receive SQS message")
 	}
@@ -203,28 +433,71 @@ func verticalScaling() error {
 		log.Info("No new messages to process, skipping...")
 		return nil
 	}
+	metrics.MessagesReceived.Inc()
+
+	correlationID := getCorrelationID(message)
+	defer func() {
+		if err != nil {
+			err = errors.Wrapf(err, "Correlation ID (%s)", correlationID)
+		}
+	}()
+	run.SetAttributes(spanAttributes("correlation_id", correlationID)...)
+	defer func() {
+		endSpan(run, err)
+	}()
 
+	_, span = startSpan(ctx, "decodeSQSMessage")
 	sqsMessage, err := decodeSQSMessage(message)
+	endSpan(span, err)
 	if err != nil {
 		return errors.Wrap(err, "Failed to decode SQS message")
 	}
 
 	var dbInstance DBInstance
 	dbInstance.DBInstanceIdentifier = sqsMessage.Trigger.Dimensions[0].Value
+	dbInstance.CorrelationID = correlationID
+	dbInstance.Context = ctx
+	run.SetAttributes(spanAttributes("alarm_name", sqsMessage.AlarmName, "db.instance", dbInstance.DBInstanceIdentifier)...)
+	dbInstance.addLogFields(log.Fields{"alarm_name": sqsMessage.AlarmName})
+
+	suppression, err := getScalingSuppression(clients.SSM, time.Now().UTC())
+	if err != nil {
+		return errors.Wrap(err, "Failed to check if vertical scaling is suppressed")
+	}
+	if suppression != "" {
+		return dbInstance.suppressScaling(SQSClient, message, suppression, time.Time{})
+	}
 
-	log.Infof("Vertical scaling of multitenant database (%s) is needed. Getting database information", dbInstance.DBInstanceIdentifier)
+	dbInstance.logger().Infof("Vertical scaling of multitenant database (%s) is needed. Getting database information", dbInstance.DBInstanceIdentifier)
 	err = dbInstance.getDatabaseInfo(RDSClient)
 	if err != nil {
 		return errors.Wrapf(err, "Failed to obtain DB instance (%s) information", dbInstance.DBInstanceIdentifier)
 	}
+	dbInstance.addLogFields(log.Fields{"cluster": dbInstance.DBClusterIdentifier})
 
-	IsArm := strings.Contains(dbInstance.DBInstanceClass, "g.")
+	now := time.Now().UTC()
+	suppression, err = dbInstance.getClusterScalingSuppression(now)
+	if err != nil {
+		return errors.Wrap(err, "Failed to check if vertical scaling is suppressed for the DB cluster")
+	}
+	if suppression != "" {
+		cooldownEnd, err := dbInstance.getCooldownEnd(now)
+		if err != nil {
+			return errors.Wrap(err, "Failed to get the end of the DB cluster scaling cooldown")
+		}
+		return dbInstance.suppressScaling(SQSClient, message, suppression, cooldownEnd)
+	}
+
+	if dbInstance.isServerless() {
+		dbInstance.logger().Infof("DB instance (%s) is serverless with capacity (%s)", dbInstance.DBInstanceIdentifier, dbInstance.ServerlessV2)
+		return dbInstance.scaleServerlessV2(SQSClient, RDSClient, cloudwatchClient, message, sqsMessage.AlarmName)
+	}
 
 	if dbInstance.getSetDBInstanceClass() {
-		if IsArm {
-			log.Infof("Current DB instance class (%s)", DBInstanceGravitonClasses[dbInstance.SizeIndex])
+		if dbInstance.IsArm {
+			dbInstance.logger().Infof("Current DB instance class (%s)", DBInstanceGravitonClasses[dbInstance.SizeIndex])
 		} else {
-			log.Infof("Current DB instance class (%s)", DBInstanceClasses[dbInstance.SizeIndex])
+			dbInstance.logger().Infof("Current DB instance class (%s)", DBInstanceClasses[dbInstance.SizeIndex])
 		}
 	} else {
 		return errors.Wrap(err, "Existing DB instance class not in the supported lists")
@@ -235,86 +508,79 @@ func verticalScaling() error {
 		return errors.Wrapf(err, "Failed to get DB instance (%s) new class type", dbInstance.DBInstanceIdentifier)
 	}
 
-	if !dbInstance.IsClusterWriter {
-		log.Infof("DB instance (%s) is a reader with instance class (%s). Calling class upgrade", dbInstance.DBInstanceIdentifier, dbInstance.DBInstanceClass)
+	newClass, err = dbInstance.migrateClassFamily(RDSClient, newClass)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to migrate DB instance (%s) new class to Graviton", dbInstance.DBInstanceIdentifier)
+	}
 
-		err := dbInstance.changeDatabaseClass(RDSClient, newClass)
-		if err != nil {
-			return errors.Wrapf(err, "Failed to change DB Instance (%s) class", dbInstance.DBInstanceIdentifier)
-		}
+	orderableClass, err := dbInstance.getOrderableClass(RDSClient, newClass)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to validate DB instance (%s) new class", dbInstance.DBInstanceIdentifier)
+	}
+	if orderableClass == "" {
+		return dbInstance.blockScaling(SQSClient, message, newClass, dbInstance.notOrderableReason(newClass))
+	}
+	newClass = orderableClass
+	dbInstance.addLogFields(log.Fields{"target_class": newClass})
+	run.SetAttributes(spanAttributes("db.cluster", dbInstance.DBClusterIdentifier, "db.from_class", dbInstance.DBInstanceClass, "db.to_class", newClass)...)
 
-		memoryAlarmName := fmt.Sprintf("%s-memory", dbInstance.DBInstanceIdentifier)
-		log.Infof("Updating Cloudwatch alarm (%s) with new metric", memoryAlarmName)
-		err = updateMemoryAlarm(cloudwatchClient, memoryAlarmName, newClass, dbInstance)
-		if err != nil {
-			return errors.Wrapf(err, "Failed to update Cloudwatch alarm (%s)", memoryAlarmName)
-		}
+	blocked, err := dbInstance.checkGuardrails(RDSClient, newClass)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to check DB instance (%s) scaling guardrails", dbInstance.DBInstanceIdentifier)
+	}
+	if blocked != "" {
+		return dbInstance.blockScaling(SQSClient, message, newClass, blocked)
+	}
 
-		connectionsAlarmName := fmt.Sprintf("%s-connections", dbInstance.DBInstanceIdentifier)
-		log.Infof("Updating Cloudwatch alarm (%s) with new metric", connectionsAlarmName)
-		err = updateConnectionsAlarm(cloudwatchClient, connectionsAlarmName, newClass, dbInstance)
-		if err != nil {
-			return errors.Wrapf(err, "Failed to update Cloudwatch alarm (%s)", connectionsAlarmName)
-		}
-	} else {
-		log.Infof("DB instance (%s) is a writer with instance class (%s). Getting first available reader", dbInstance.DBInstanceIdentifier, dbInstance.DBInstanceClass)
-		var dbInstanceReader DBInstance
-		clusterMembers, err := dbInstance.getDBClusterMembers(RDSClient)
+	if isDeferralEnabled() && !dbInstance.isCriticalAlarm(sqsMessage) {
+		deferred, err := dbInstance.deferScaling(newClass, sqsMessage.AlarmName)
 		if err != nil {
-			return errors.Wrap(err, "Failed to get DB cluster members")
-		}
-		for _, member := range clusterMembers {
-			if strings.Contains(*member.DBInstanceIdentifier, os.Getenv("RDSMultitenantDBInstanceNamePrefix")) {
-				if *member.DBInstanceIdentifier != dbInstance.DBInstanceIdentifier {
-					dbInstanceReader.DBInstanceIdentifier = *member.DBInstanceIdentifier
-				}
-			}
-		}
-		log.Infof("DB instance (%s) was selected for vertical scaling. Getting database information", dbInstanceReader.DBInstanceIdentifier)
-		err = dbInstanceReader.getDatabaseInfo(RDSClient)
-		if err != nil {
-			return errors.Wrapf(err, "Failed to obtain DB instance (%s) information", dbInstanceReader.DBInstanceIdentifier)
+			return errors.Wrapf(err, "Failed to defer DB instance (%s) vertical scaling", dbInstance.DBInstanceIdentifier)
 		}
-
-		if dbInstanceReader.getSetDBInstanceClass() {
-			if IsArm {
-				log.Infof("Current DB instance class (%s)", DBInstanceGravitonClasses[dbInstanceReader.SizeIndex])
-			} else {
-				log.Infof("Current DB instance class (%s)", DBInstanceClasses[dbInstanceReader.SizeIndex])
-			}
-		} else {
-			return errors.Wrap(err, "Existing DB instance class not in the supported list")
-		}
-
-		if (dbInstance.SizeIndex + 1) > dbInstanceReader.SizeIndex {
-			err = dbInstanceReader.changeDatabaseClass(RDSClient, newClass)
+		if deferred {
+			dbInstance.logger().Info("Vertical scaling was deferred to the maintenance window, deleting SQS message")
+			err = deleteSQSMessage(SQSClient, message)
 			if err != nil {
-				return errors.Wrapf(err, "Failed to change DB instance (%s) class", dbInstanceReader.DBInstanceIdentifier)
+				return errors.Wrap(err, "failed to delete SQS message")
 			}
+			return nil
 		}
+	}
 
-		log.Infof("Initiating DB instance (%s) failover", dbInstanceReader.DBInstanceIdentifier)
-		err = dbInstanceReader.databaseFailover(RDSClient)
+	approvalReason, err := dbInstance.getApprovalReason(newClass)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to check if DB instance (%s) vertical scaling requires approval", dbInstance.DBInstanceIdentifier)
+	}
+	if approvalReason != "" {
+		err = dbInstance.requestApproval(newClass, sqsMessage.AlarmName, approvalReason)
 		if err != nil {
-			return errors.Wrapf(err, "Failed to failover DB instance (%s)", dbInstanceReader.DBInstanceIdentifier)
+			return errors.Wrapf(err, "Failed to request approval for DB instance (%s) vertical scaling", dbInstance.DBInstanceIdentifier)
 		}
-
-		memoryAlarmName := fmt.Sprintf("%s-memory", dbInstanceReader.DBInstanceIdentifier)
-		log.Infof("Updating Cloudwatch alarm (%s) with new metric", memoryAlarmName)
-		err = updateMemoryAlarm(cloudwatchClient, memoryAlarmName, newClass, dbInstance)
+		dbInstance.logger().Info("Vertical scaling is waiting for approval, deleting SQS message")
+		err = deleteSQSMessage(SQSClient, message)
 		if err != nil {
-			return errors.Wrapf(err, "Failed to update Cloudwatch alarm (%s)", memoryAlarmName)
+			return errors.Wrap(err, "failed to delete SQS message")
 		}
+		return nil
+	}
 
-		connectionsAlarmName := fmt.Sprintf("%s-connections", dbInstanceReader.DBInstanceIdentifier)
-		log.Infof("Updating Cloudwatch alarm (%s) with new metric", connectionsAlarmName)
-		err = updateConnectionsAlarm(cloudwatchClient, connectionsAlarmName, newClass, dbInstance)
-		if err != nil {
-			return errors.Wrapf(err, "Failed to update Cloudwatch alarm (%s)", connectionsAlarmName)
-		}
+	err = dbInstance.notifyScalingStarted(newClass)
+	if err != nil {
+		dbInstance.logger().WithError(err).Error("failed to send Mattermost notification")
+	}
+
+	err = scaleDBInstance(RDSClient, cloudwatchClient, dbInstance, newClass)
+	if err != nil {
+		return dbInstance.scalingFailed(err)
+	}
+	dbInstance.recordScaling(time.Now().UTC())
+
+	err = dbInstance.publishScalingAction(newClass, ScalingTriggerAlarm)
+	if err != nil {
+		dbInstance.logger().WithError(err).Error("Failed to publish scaling action")
 	}
 
-	log.Info("Vertical scaling was successfully handled, deleting SQS message")
+	dbInstance.logger().Info("Vertical scaling was successfully handled, deleting SQS message")
 
 	err = deleteSQSMessage(SQSClient, message)
 	if err != nil {
@@ -323,135 +589,201 @@ func verticalScaling() error {
 
 	err = dbInstance.sendMattermostNotification(newClass, "Vertical scaling was succesfully handled")
 	if err != nil {
-		log.WithError(err).Error("failed tο send Mattermost notification")
+		dbInstance.logger().WithError(err).Error("failed to send Mattermost notification")
 	}
 	return nil
 }
 
-func updateMemoryAlarm(client *cloudwatch.CloudWatch, alarmName, instanceClass string, dbInstance DBInstance) error {
-	alarms, err := client.DescribeAlarms(&cloudwatch.DescribeAlarmsInput{
-		AlarmNames: []*string{&alarmName},
-	})
-	if err != nil {
-		return errors.Wrap(err, "Failed to describe Cloudwatch alarms")
+// suppressScaling leaves the scaling request on the queue without touching the DB instance and notifies about it. The
+// SQS message is hidden until retryAt, such as the end of the cooldown, or until the end of the suppression when
+// retryAt is zero, so that the request is handled once scaling is allowed again.
+func (d *DBInstance) suppressScaling(client *sqs.SQS, message *sqs.ReceiveMessageOutput, reason string, retryAt time.Time) error {
+	now := time.Now().UTC()
+	if retryAt.IsZero() {
+		var err error
+		retryAt, err = getSuppressionRetryTime(now)
+		if err != nil {
+			return errors.Wrap(err, "Failed to get the retry time of the suppressed vertical scaling")
+		}
+	}
+	delay := retryAt.Sub(now)
+	if delay < 0 {
+		delay = 0
+	}
+	if delay > MaxSQSVisibilityTimeout {
+		delay = MaxSQSVisibilityTimeout
 	}
 
-	newAlarm, err := updateMemoryAlarmMetric(alarms, instanceClass, dbInstance)
+	d.logger().Warnf("%s. Skipping vertical scaling of DB instance (%s) and hiding SQS message for %s", reason, d.DBInstanceIdentifier, delay.Round(time.Second))
+	err := delaySQSMessage(client, message, delay)
 	if err != nil {
-		return errors.Wrap(err, "Failed to set data to new Cloudwatch alarm")
+		return errors.Wrap(err, "failed to delay SQS message")
 	}
 
-	_, err = client.PutMetricAlarm(&cloudwatch.PutMetricAlarmInput{
-		AlarmName:          aws.String(alarmName),
-		Metrics:            newAlarm.Metrics,
-		EvaluationPeriods:  newAlarm.EvaluationPeriods,
-		ComparisonOperator: newAlarm.ComparisonOperator,
-		Threshold:          newAlarm.Threshold,
-		MetricName:         newAlarm.MetricName,
-		Period:             newAlarm.Period,
-		Namespace:          newAlarm.Namespace,
-		Statistic:          newAlarm.Statistic,
-		TreatMissingData:   newAlarm.TreatMissingData,
-		AlarmDescription:   newAlarm.AlarmDescription,
-		Dimensions:         newAlarm.Dimensions,
-		DatapointsToAlarm:  newAlarm.DatapointsToAlarm,
-		AlarmActions:       newAlarm.AlarmActions,
-	})
+	err = d.sendMattermostSuppressedNotification(fmt.Sprintf("%s. The request is retried at %s", reason, now.Add(delay).Format(time.RFC3339)))
 	if err != nil {
-		return errors.Wrap(err, "Failed to update Cloudwatch alarm")
+		d.logger().WithError(err).Error("failed to send Mattermost notification")
 	}
 	return nil
 }
 
-func updateConnectionsAlarm(client *cloudwatch.CloudWatch, alarmName, instanceClass string, dbInstance DBInstance) error {
-	alarms, err := client.DescribeAlarms(&cloudwatch.DescribeAlarmsInput{
-		AlarmNames: []*string{&alarmName},
-	})
+// blockScaling drops the scaling request that violates a guardrail and escalates it via the alerts hook.
+func (d *DBInstance) blockScaling(client *sqs.SQS, message *sqs.ReceiveMessageOutput, newClass, reason string) error {
+	d.logger().Warnf("%s. Blocking vertical scaling of DB instance (%s) and deleting SQS message", reason, d.DBInstanceIdentifier)
+	err := deleteSQSMessage(client, message)
 	if err != nil {
-		return errors.Wrap(err, "Failed to describe Cloudwatch alarms")
+		return errors.Wrap(err, "failed to delete SQS message")
 	}
 
-	newAlarm, err := updateConnectionsAlarmMetric(alarms, instanceClass, dbInstance)
+	err = d.sendMattermostBlockedNotification(newClass, reason)
 	if err != nil {
-		return errors.Wrap(err, "Failed to set data to new Cloudwatch alarm")
+		d.logger().WithError(err).Error("failed to send Mattermost alert")
 	}
+	return nil
+}
 
-	_, err = client.PutMetricAlarm(&cloudwatch.PutMetricAlarmInput{
-		AlarmName:          aws.String(alarmName),
-		Metrics:            newAlarm.Metrics,
-		EvaluationPeriods:  newAlarm.EvaluationPeriods,
-		ComparisonOperator: newAlarm.ComparisonOperator,
-		Threshold:          newAlarm.Threshold,
-		MetricName:         newAlarm.MetricName,
-		Period:             newAlarm.Period,
-		Namespace:          newAlarm.Namespace,
-		Statistic:          newAlarm.Statistic,
-		TreatMissingData:   newAlarm.TreatMissingData,
-		AlarmDescription:   newAlarm.AlarmDescription,
-		Dimensions:         newAlarm.Dimensions,
-		DatapointsToAlarm:  newAlarm.DatapointsToAlarm,
-		AlarmActions:       newAlarm.AlarmActions,
-	})
+// scaleDBInstance upgrades the DB instance to the new class. Readers are modified in place, while for writers the
+// first available reader is upgraded and promoted via failover. Standalone DB instances are modified in place.
+func scaleDBInstance(RDSClient *rds.RDS, cloudwatchClient *cloudwatch.CloudWatch, dbInstance DBInstance, newClass string) (err error) {
+	var span trace.Span
+	dbInstance.Context, span = startSpan(dbInstance.Context, "scaleDBInstance", "db.instance", dbInstance.DBInstanceIdentifier, "db.to_class", newClass)
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	if dbInstance.isStandalone() {
+		return scaleStandaloneDBInstance(RDSClient, cloudwatchClient, dbInstance, newClass)
+	}
+
+	membersBefore, err := dbInstance.getClusterMemberStates(RDSClient)
 	if err != nil {
-		return errors.Wrap(err, "Failed to update Cloudwatch alarm")
+		return errors.Wrap(err, "Failed to get DB cluster members state")
 	}
-	return nil
-}
 
-func updateMemoryAlarmMetric(alarms *cloudwatch.DescribeAlarmsOutput, instanceClass string, dbInstance DBInstance) (*cloudwatch.MetricAlarm, error) {
-	if len(alarms.MetricAlarms) > 0 {
-		for _, metricAlarm := range alarms.MetricAlarms {
-			if len(metricAlarm.Metrics) > 0 {
-				for index, metric := range metricAlarm.Metrics {
-					if *metric.Id == "e1" {
-						if dbInstance.IsArm {
-							metricAlarm.Metrics[index].Expression = aws.String(fmt.Sprintf("m1 + %s*%s", os.Getenv("MemoryCacheProportion"), DBInstanceGravitonClassMemory[instanceClass]))
-							return metricAlarm, nil
-						}
-						metricAlarm.Metrics[index].Expression = aws.String(fmt.Sprintf("m1 + %s*%s", os.Getenv("MemoryCacheProportion"), DBInstanceClassMemory[instanceClass]))
-						return metricAlarm, nil
-					}
-				}
+	if !dbInstance.IsClusterWriter {
+		dbInstance.logger().Infof("DB instance (%s) is a reader with instance class (%s). Calling class upgrade", dbInstance.DBInstanceIdentifier, dbInstance.DBInstanceClass)
+
+		err = dbInstance.changeDatabaseClass(RDSClient, newClass)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to change DB Instance (%s) class", dbInstance.DBInstanceIdentifier)
+		}
+		dbInstance.reportProgress(fmt.Sprintf("Reader (%s) upgraded to class (%s)", dbInstance.DBInstanceIdentifier, newClass))
+	} else {
+		dbInstance.logger().Infof("DB instance (%s) is a writer with instance class (%s). Getting first available reader", dbInstance.DBInstanceIdentifier, dbInstance.DBInstanceClass)
+		var dbInstanceReader DBInstance
+		dbInstanceReader.Log = dbInstance.logger()
+		dbInstanceReader.Context = dbInstance.Context
+		clusterMembers, err := dbInstance.getDBClusterMembers(RDSClient)
+		if err != nil {
+			return errors.Wrap(err, "Failed to get DB cluster members")
+		}
+		dbInstanceReader.DBInstanceIdentifier = dbInstance.selectFailoverReader(clusterMembers, membersBefore)
+		dbInstanceReader.addLogFields(log.Fields{"reader": dbInstanceReader.DBInstanceIdentifier})
+		dbInstance.logger().Infof("DB instance (%s) was selected for vertical scaling. Getting database information", dbInstanceReader.DBInstanceIdentifier)
+		dbInstance.reportProgress(fmt.Sprintf("Reader (%s) selected to replace the writer", dbInstanceReader.DBInstanceIdentifier))
+		err = dbInstanceReader.getDatabaseInfo(RDSClient)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to obtain DB instance (%s) information", dbInstanceReader.DBInstanceIdentifier)
+		}
+
+		if dbInstanceReader.getSetDBInstanceClass() {
+			if dbInstanceReader.IsArm {
+				dbInstance.logger().Infof("Current DB instance class (%s)", DBInstanceGravitonClasses[dbInstanceReader.SizeIndex])
+			} else {
+				dbInstance.logger().Infof("Current DB instance class (%s)", DBInstanceClasses[dbInstanceReader.SizeIndex])
 			}
+		} else {
+			return errors.Wrap(err, "Existing DB instance class not in the supported list")
 		}
-	}
-	return nil, errors.Errorf("Failed to get existing alarms")
-}
 
-func updateConnectionsAlarmMetric(alarms *cloudwatch.DescribeAlarmsOutput, instanceClass string, dbInstance DBInstance) (*cloudwatch.MetricAlarm, error) {
+		readerMemory, err := getClassMemory(dbInstanceReader.DBInstanceClass)
+		if err != nil {
+			return err
+		}
+		newMemory, err := getClassMemory(newClass)
+		if err != nil {
+			return err
+		}
+		if dbInstanceReader.DBInstanceClass != newClass && readerMemory <= newMemory {
+			err = dbInstanceReader.changeDatabaseClass(RDSClient, newClass)
+			if err != nil {
+				return errors.Wrapf(err, "Failed to change DB instance (%s) class", dbInstanceReader.DBInstanceIdentifier)
+			}
+			dbInstance.reportProgress(fmt.Sprintf("Reader (%s) upgraded to class (%s)", dbInstanceReader.DBInstanceIdentifier, newClass))
+		}
 
-	connectionsSafetyPercentage, _ := strconv.ParseFloat(os.Getenv("ConnectionsSafetyPercentage"), 64)
-	divider, _ := strconv.ParseFloat(os.Getenv("MemoryConnectionsDivider"), 64)
+		dbInstance.logger().Infof("Initiating DB instance (%s) failover", dbInstanceReader.DBInstanceIdentifier)
+		failoverStart := time.Now()
+		err = dbInstanceReader.databaseFailover(RDSClient)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to failover DB instance (%s)", dbInstanceReader.DBInstanceIdentifier)
+		}
 
-	if len(alarms.MetricAlarms) > 0 {
-		for _, metricAlarm := range alarms.MetricAlarms {
-			if *metricAlarm.MetricName == "DatabaseConnections" {
-				if dbInstance.IsArm {
-					memoryFloat, err := strconv.ParseFloat(DBInstanceGravitonClassMemory[instanceClass], 64)
-					if err != nil {
-						return nil, errors.Wrap(err, "unable to change memory to float number")
-					}
-					metricAlarm.Threshold = aws.Float64(connectionsSafetyPercentage * (memoryFloat / divider))
-					return metricAlarm, nil
-				}
-				memoryFloat, err := strconv.ParseFloat(DBInstanceClassMemory[instanceClass], 64)
-				if err != nil {
-					return nil, errors.Wrap(err, "unable to change memory to float number")
-				}
-				metricAlarm.Threshold = aws.Float64(connectionsSafetyPercentage * (memoryFloat / divider))
-				return metricAlarm, nil
-			}
+		wait := 300
+		dbInstance.logger().Infof("Waiting up to %d seconds for DB instance (%s) to become the writer...", wait, dbInstanceReader.DBInstanceIdentifier)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(wait)*time.Second)
+		defer cancel()
+		waitStart := time.Now()
+		_, span := startSpan(dbInstance.Context, "waitForFailover", "db.cluster", dbInstance.DBClusterIdentifier, "db.instance", dbInstanceReader.DBInstanceIdentifier)
+		err = dbInstanceReader.waitForFailover(ctx, RDSClient)
+		endSpan(span, err)
+		observeSince(metrics.WaiterDuration.WithLabelValues("failover"), waitStart)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to failover DB instance (%s)", dbInstanceReader.DBInstanceIdentifier)
 		}
+		observeSince(metrics.FailoverDuration, failoverStart)
+		dbInstance.reportProgress(fmt.Sprintf("Failover completed, (%s) is the writer", dbInstanceReader.DBInstanceIdentifier))
 	}
-	return nil, errors.Errorf("Failed to get existing alarms")
+
+	membersAfter, err := dbInstance.getClusterMemberStates(RDSClient)
+	if err != nil {
+		return errors.Wrap(err, "Failed to get DB cluster members state")
+	}
+
+	for identifier, member := range membersAfter {
+		if previous, ok := membersBefore[identifier]; ok && previous == member {
+			continue
+		}
+		dbInstance.logger().Infof("DB instance (%s) is now a %s with instance class (%s). Updating Cloudwatch alarms", identifier, member.role(), member.Class)
+		_, err = reconcileDBInstanceAlarms(dbInstance.Context, dbInstance.stepLogger("updateAlarms"), RDSClient, cloudwatchClient, identifier, member.Class, true)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to update DB instance (%s) Cloudwatch alarms", identifier)
+		}
+	}
+
+	dbInstance.reportProgress("Cloudwatch alarms updated")
+	metrics.ScalingActions.WithLabelValues(dbInstance.scalingGroup(), dbInstance.DBInstanceClass, newClass).Inc()
+
+	// The DB cluster is already scaled, so a failed warmup suppression must not fail the run.
+	err = suppressAlarmsForWarmup(cloudwatchClient, dbInstance.scalingGroup(), membersAfter)
+	if err != nil {
+		dbInstance.warnWarmupSuppressionFailure(err)
+	}
+
+	return nil
 }
 
-func getAWSClients() (*sqs.SQS, *rds.RDS, *cloudwatch.CloudWatch, error) {
+// AWSClients is used to store the AWS service clients used by the tool.
+type AWSClients struct {
+	SQS         *sqs.SQS
+	RDS         *rds.RDS
+	CloudWatch  *cloudwatch.CloudWatch
+	SSM         *ssm.SSM
+	EventBridge *eventbridge.EventBridge
+}
+
+func getAWSClients() (*AWSClients, error) {
 	sess, err := session.NewSession(&aws.Config{})
 	if err != nil {
-		return nil, nil, nil, errors.Wrap(err, "unable to initiate AWS session")
+		return nil, errors.Wrap(err, "unable to initiate AWS session")
 	}
-	return sqs.New(sess), rds.New(sess), cloudwatch.New(sess), nil
+	return &AWSClients{
+		SQS:         sqs.New(sess),
+		RDS:         rds.New(sess),
+		CloudWatch:  cloudwatch.New(sess),
+		SSM:         ssm.New(sess),
+		EventBridge: eventbridge.New(sess),
+	}, nil
 }
 
 func getSQSMessage(client *sqs.SQS) (*sqs.ReceiveMessageOutput, error) {
@@ -487,6 +819,21 @@ func deleteSQSMessage(client *sqs.SQS, message *sqs.ReceiveMessageOutput) error
 	if err != nil {
 		return errors.Wrap(err, "unable to delete SQS message")
 	}
+	metrics.MessagesProcessed.Inc()
+	return nil
+}
+
+// delaySQSMessage hides the received message for the delay, after which it is received again.
+func delaySQSMessage(client *sqs.SQS, message *sqs.ReceiveMessageOutput, delay time.Duration) error {
+	queueURL := os.Getenv("QueueURL")
+	_, err := client.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          &queueURL,
+		ReceiptHandle:     message.Messages[0].ReceiptHandle,
+		VisibilityTimeout: aws.Int64(int64(delay.Seconds())),
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to change SQS message visibility")
+	}
 	return nil
 }
 
@@ -505,7 +852,9 @@ func (d *DBInstance) getDBClusterMembers(client *rds.RDS) ([]*rds.DBClusterMembe
 }
 
 func (d *DBInstance) getDatabaseInfo(client *rds.RDS) error {
+	_, span := startSpan(d.Context, "rds.DescribeDBInstances", "db.instance", d.DBInstanceIdentifier)
 	databaseInstances, err := client.DescribeDBInstances(&rds.DescribeDBInstancesInput{DBInstanceIdentifier: &d.DBInstanceIdentifier})
+	endSpan(span, err)
 	if err != nil {
 		return errors.Wrap(err, "unable to describe DB instance")
 	}
@@ -515,9 +864,17 @@ func (d *DBInstance) getDatabaseInfo(client *rds.RDS) error {
 	}
 	(*d).DBInstanceStatus = *databaseInstances.DBInstances[0].DBInstanceStatus
 	(*d).DBInstanceClass = *databaseInstances.DBInstances[0].DBInstanceClass
+	(*d).Engine = aws.StringValue(databaseInstances.DBInstances[0].Engine)
+	(*d).EngineVersion = aws.StringValue(databaseInstances.DBInstances[0].EngineVersion)
+	(*d).AvailabilityZone = aws.StringValue(databaseInstances.DBInstances[0].AvailabilityZone)
+	if databaseInstances.DBInstances[0].DBClusterIdentifier == nil {
+		return d.getStandaloneDatabaseInfo(client, databaseInstances.DBInstances[0])
+	}
 	(*d).DBClusterIdentifier = *databaseInstances.DBInstances[0].DBClusterIdentifier
 
+	_, span = startSpan(d.Context, "rds.DescribeDBClusters", "db.cluster", d.DBClusterIdentifier)
 	databaseClusters, err := client.DescribeDBClusters(&rds.DescribeDBClustersInput{DBClusterIdentifier: &d.DBClusterIdentifier})
+	endSpan(span, err)
 	if err != nil {
 		return errors.Wrap(err, "unable to describe the DB Cluster")
 	}
@@ -525,11 +882,31 @@ func (d *DBInstance) getDatabaseInfo(client *rds.RDS) error {
 	if len(databaseClusters.DBClusters) == 0 {
 		return errors.Wrap(err, "list of DB Clusters empty")
 	}
+	(*d).MaintenanceWindow = aws.StringValue(databaseClusters.DBClusters[0].PreferredMaintenanceWindow)
+	(*d).DBClusterArn = aws.StringValue(databaseClusters.DBClusters[0].DBClusterArn)
 	for _, member := range databaseClusters.DBClusters[0].DBClusterMembers {
 		if *member.DBInstanceIdentifier == d.DBInstanceIdentifier {
 			(*d).IsClusterWriter = *member.IsClusterWriter
 		}
 	}
+
+	_, span = startSpan(d.Context, "rds.ListTagsForResource", "db.cluster", d.DBClusterIdentifier)
+	tags, err := client.ListTagsForResource(&rds.ListTagsForResourceInput{ResourceName: &d.DBClusterArn})
+	endSpan(span, err)
+	if err != nil {
+		return errors.Wrap(err, "unable to list the DB Cluster tags")
+	}
+	(*d).ClusterTags = make(map[string]string)
+	for _, tag := range tags.TagList {
+		(*d).ClusterTags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+
+	(*d).Policy, err = getScalingPolicy(d.ClusterTags)
+	if err != nil {
+		return errors.Wrap(err, "unable to get the DB Cluster scaling policy")
+	}
+
+	(*d).ServerlessV2 = (*ServerlessV2Capacity)(databaseClusters.DBClusters[0].ServerlessV2ScalingConfiguration)
 	return nil
 }
 
@@ -539,14 +916,14 @@ func (d *DBInstance) getNewClassType() (string, error) {
 		if err != nil {
 			return "", err
 		}
-		log.Infof("New DB Graviton instance class (%s)", newClass)
+		d.stepLogger("getNewClassType").Infof("New DB Graviton instance class (%s)", newClass)
 		return newClass, nil
 	}
 	newClass, err := d.increaseSize()
 	if err != nil {
 		return "", err
 	}
-	log.Infof("New DB instance class (%s)", newClass)
+	d.stepLogger("getNewClassType").Infof("New DB instance class (%s)", newClass)
 	return newClass, nil
 
 }
@@ -572,7 +949,7 @@ func (d DBInstance) increaseSize() (string, error) {
 	if (newIndex + 1) >= len(DBInstanceClasses) {
 		return "", errors.Errorf("Maximum instance size used. Index out of range")
 	}
-	return DBInstanceClasses[newIndex], nil
+	return d.Policy.applyToLadder(DBInstanceClasses, newIndex)
 }
 
 func (d DBInstance) increaseSizeArm() (string, error) {
@@ -580,7 +957,7 @@ func (d DBInstance) increaseSizeArm() (string, error) {
 	if (newIndex + 1) >= len(DBInstanceGravitonClasses) {
 		return "", errors.Errorf("Maximum instance size used. Index out of range")
 	}
-	return DBInstanceGravitonClasses[newIndex], nil
+	return d.Policy.applyToLadder(DBInstanceGravitonClasses, newIndex)
 }
 
 func (d *DBInstance) changeDatabaseClass(client *rds.RDS, dbInstanceClass string) error {
@@ -589,28 +966,40 @@ func (d *DBInstance) changeDatabaseClass(client *rds.RDS, dbInstanceClass string
 		DBInstanceClass:      aws.String(dbInstanceClass),
 		DBInstanceIdentifier: aws.String(d.DBInstanceIdentifier),
 	}
-	log.Infof("Upgrading database (%s) to class (%s)", d.DBInstanceIdentifier, dbInstanceClass)
+	d.stepLogger("changeDatabaseClass").Infof("Upgrading database (%s) to class (%s)", d.DBInstanceIdentifier, dbInstanceClass)
+	resizeStart := time.Now()
+	_, span := startSpan(d.Context, "rds.ModifyDBInstance", "db.instance", d.DBInstanceIdentifier, "db.to_class", dbInstanceClass)
 	_, err := client.ModifyDBInstance(modifyDBInstanceInput)
+	endSpan(span, err)
 	if err != nil {
 		return errors.Wrap(err, "unable to upgrade database to new class")
 	}
 	wait := 300
-	log.Infof("Waiting up to %d seconds for db instance to start modifications...", wait)
+	d.stepLogger("changeDatabaseClass").Infof("Waiting up to %d seconds for db instance to start modifications...", wait)
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(wait)*time.Second)
 	defer cancel()
+	waitStart := time.Now()
+	_, span = startSpan(d.Context, "waitForDBInstanceStartModifications", "db.instance", d.DBInstanceIdentifier)
 	err = d.waitForDBInstanceStartModifications(ctx, client)
+	endSpan(span, err)
+	observeSince(metrics.WaiterDuration.WithLabelValues("start_modifications"), waitStart)
 	if err != nil {
 		return err
 	}
 
 	wait = 1000
-	log.Infof("Waiting up to %d seconds for db instance to become available...", wait)
+	d.stepLogger("changeDatabaseClass").Infof("Waiting up to %d seconds for db instance to become available...", wait)
 	ctx, cancel = context.WithTimeout(context.Background(), time.Duration(wait)*time.Second)
 	defer cancel()
+	waitStart = time.Now()
+	_, span = startSpan(d.Context, "waitForDBInstanceReady", "db.instance", d.DBInstanceIdentifier)
 	err = d.waitForDBInstanceReady(ctx, client)
+	endSpan(span, err)
+	observeSince(metrics.WaiterDuration.WithLabelValues("available"), waitStart)
 	if err != nil {
 		return err
 	}
+	observeSince(metrics.ResizeDuration, resizeStart)
 
 	return nil
 }
@@ -625,11 +1014,11 @@ func (d *DBInstance) waitForDBInstanceReady(ctx context.Context, client *rds.RDS
 
 			databaseInstances, err := client.DescribeDBInstances(&rds.DescribeDBInstancesInput{DBInstanceIdentifier: &d.DBInstanceIdentifier})
 			if err != nil {
-				log.WithError(err).Error("unable to describe DB instance")
+				d.stepLogger("waitForDBInstanceReady").WithError(err).Error("unable to describe DB instance")
 			}
 
 			if len(databaseInstances.DBInstances) == 0 {
-				log.Error("List of DB instances empty")
+				d.stepLogger("waitForDBInstanceReady").Error("List of DB instances empty")
 			} else {
 				if *databaseInstances.DBInstances[0].DBInstanceStatus != "available" {
 					shouldWait = true
@@ -639,7 +1028,7 @@ func (d *DBInstance) waitForDBInstanceReady(ctx context.Context, client *rds.RDS
 
 				if !shouldWait {
 					(*d).DBInstanceStatus = *databaseInstances.DBInstances[0].DBInstanceStatus
-					log.Infof("DB instance (%s) status (%s)", d.DBInstanceIdentifier, d.DBInstanceStatus)
+					d.stepLogger("waitForDBInstanceReady").Infof("DB instance (%s) status (%s)", d.DBInstanceIdentifier, d.DBInstanceStatus)
 					return nil
 				}
 			}
@@ -659,11 +1048,11 @@ func (d *DBInstance) waitForDBInstanceStartModifications(ctx context.Context, cl
 
 			databaseInstances, err := client.DescribeDBInstances(&rds.DescribeDBInstancesInput{DBInstanceIdentifier: &d.DBInstanceIdentifier})
 			if err != nil {
-				log.WithError(err).Error("unable to describe DB instance")
+				d.stepLogger("waitForDBInstanceStartModifications").WithError(err).Error("unable to describe DB instance")
 			}
 
 			if len(databaseInstances.DBInstances) == 0 {
-				log.Error("List of DB instances empty")
+				d.stepLogger("waitForDBInstanceStartModifications").Error("List of DB instances empty")
 			} else {
 				if *databaseInstances.DBInstances[0].DBInstanceStatus == "available" {
 					shouldWait = true
@@ -673,7 +1062,7 @@ func (d *DBInstance) waitForDBInstanceStartModifications(ctx context.Context, cl
 
 				if !shouldWait {
 					(*d).DBInstanceStatus = *databaseInstances.DBInstances[0].DBInstanceStatus
-					log.Infof("DB instance (%s) status (%s)", d.DBInstanceIdentifier, d.DBInstanceStatus)
+					d.stepLogger("waitForDBInstanceStartModifications").Infof("DB instance (%s) status (%s)", d.DBInstanceIdentifier, d.DBInstanceStatus)
 					return nil
 				}
 			}
@@ -684,16 +1073,101 @@ func (d *DBInstance) waitForDBInstanceStartModifications(ctx context.Context, cl
 }
 
 func (d *DBInstance) databaseFailover(client *rds.RDS) error {
+	_, span := startSpan(d.Context, "rds.FailoverDBCluster", "db.cluster", d.DBClusterIdentifier, "db.instance", d.DBInstanceIdentifier)
 	_, err := client.FailoverDBCluster(&rds.FailoverDBClusterInput{
 		DBClusterIdentifier:        &d.DBClusterIdentifier,
 		TargetDBInstanceIdentifier: &d.DBInstanceIdentifier,
 	})
+	endSpan(span, err)
 	if err != nil {
 		return errors.Wrap(err, "unable to failover DB cluster")
 	}
+	metrics.Failovers.WithLabelValues(d.DBClusterIdentifier).Inc()
 	return nil
 }
 
+func (d *DBInstance) waitForFailover(ctx context.Context, client *rds.RDS) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "timed out waiting for database failover")
+		default:
+			databaseClusters, err := client.DescribeDBClusters(&rds.DescribeDBClustersInput{DBClusterIdentifier: &d.DBClusterIdentifier})
+			if err != nil {
+				d.stepLogger("waitForFailover").WithError(err).Error("unable to describe DB cluster")
+			} else if len(databaseClusters.DBClusters) == 0 {
+				d.stepLogger("waitForFailover").Error("List of DB clusters empty")
+			} else {
+				for _, member := range databaseClusters.DBClusters[0].DBClusterMembers {
+					if *member.DBInstanceIdentifier == d.DBInstanceIdentifier && *member.IsClusterWriter {
+						(*d).IsClusterWriter = true
+						d.stepLogger("waitForFailover").Infof("DB instance (%s) is the cluster writer", d.DBInstanceIdentifier)
+						return nil
+					}
+				}
+			}
+
+			time.Sleep(5 * time.Second)
+		}
+	}
+}
+
+// ClusterMemberState is used to store the class and role of a DB cluster member.
+type ClusterMemberState struct {
+	Class    string
+	IsWriter bool
+}
+
+func (m ClusterMemberState) role() string {
+	if m.IsWriter {
+		return "writer"
+	}
+	return "reader"
+}
+
+// selectFailoverReader returns the reader that is upgraded to replace the writer, which is the last multitenant member
+// of the DB cluster that is neither the writer nor a Serverless v2 instance.
+func (d *DBInstance) selectFailoverReader(clusterMembers []*rds.DBClusterMember, members map[string]ClusterMemberState) string {
+	var reader string
+	for _, member := range clusterMembers {
+		if strings.Contains(*member.DBInstanceIdentifier, os.Getenv("RDSMultitenantDBInstanceNamePrefix")) {
+			if *member.DBInstanceIdentifier != d.DBInstanceIdentifier && members[*member.DBInstanceIdentifier].Class != DBInstanceClassServerless {
+				reader = *member.DBInstanceIdentifier
+			}
+		}
+	}
+	return reader
+}
+
+// getClusterMemberStates returns the class and role of every multitenant member of the DB cluster.
+func (d *DBInstance) getClusterMemberStates(client *rds.RDS) (map[string]ClusterMemberState, error) {
+	clusterMembers, err := d.getDBClusterMembers(client)
+	if err != nil {
+		return nil, err
+	}
+
+	databaseInstances, err := client.DescribeDBInstances(&rds.DescribeDBInstancesInput{
+		Filters: []*rds.Filter{{Name: aws.String("db-cluster-id"), Values: []*string{aws.String(d.DBClusterIdentifier)}}},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to describe DB cluster instances")
+	}
+	classes := make(map[string]string)
+	for _, instance := range databaseInstances.DBInstances {
+		classes[aws.StringValue(instance.DBInstanceIdentifier)] = aws.StringValue(instance.DBInstanceClass)
+	}
+
+	states := make(map[string]ClusterMemberState)
+	for _, member := range clusterMembers {
+		identifier := aws.StringValue(member.DBInstanceIdentifier)
+		if !strings.Contains(identifier, os.Getenv("RDSMultitenantDBInstanceNamePrefix")) {
+			continue
+		}
+		states[identifier] = ClusterMemberState{Class: classes[identifier], IsWriter: aws.BoolValue(member.IsClusterWriter)}
+	}
+	return states, nil
+}
+
 // Helper function which returns true when the instance is ARM architecture. Also sets IsArm value of the DBInstance.
 func (d *DBInstance) isArm() bool {
 	d.IsArm = strings.Contains(d.DBInstanceClass, "g.")
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PendingAction is used to store a vertical scaling action deferred to a maintenance window.
+type PendingAction struct {
+	DBInstanceIdentifier string    `json:"dbInstanceIdentifier"`
+	DBClusterIdentifier  string    `json:"dbClusterIdentifier"`
+	CurrentClass         string    `json:"currentClass"`
+	NewClass             string    `json:"newClass"`
+	AlarmName            string    `json:"alarmName"`
+	MaintenanceWindow    string    `json:"maintenanceWindow"`
+	WindowStart          time.Time `json:"windowStart"`
+	WindowEnd            time.Time `json:"windowEnd"`
+	CorrelationID        string    `json:"correlationId"`
+	// ServerlessV2 is the capacity a Serverless v2 DB cluster is scaled to. NewClass holds its description.
+	ServerlessV2 *ServerlessV2Capacity `json:"serverlessV2,omitempty"`
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+var datapointRegexp = regexp.MustCompile(`\[([-+0-9.eE]+) \(`)
+
+func isDeferralEnabled() bool {
+	return os.Getenv("DeferNonCriticalScaling") == "true"
+}
+
+// getMaintenanceWindow returns the configured maintenance window, falling back to the preferred maintenance window of the DB cluster.
+func (d *DBInstance) getMaintenanceWindow() string {
+	if os.Getenv("MaintenanceWindow") != "" {
+		return os.Getenv("MaintenanceWindow")
+	}
+	return d.MaintenanceWindow
+}
+
+// isCriticalAlarm returns true when the alarm has to be handled immediately. Alarms for classes at the lower end of
+// the ladder and alarms where the datapoint is only slightly over the threshold are not critical.
+func (d *DBInstance) isCriticalAlarm(message Message) bool {
+	if index, err := strconv.Atoi(os.Getenv("DeferBelowClassIndex")); err == nil && d.SizeIndex < index {
+		d.logger().Infof("DB instance class (%s) is at the lower end of the ladder, alarm is not critical", d.DBInstanceClass)
+		return false
+	}
+
+	criticalSeverity, err := strconv.ParseFloat(os.Getenv("CriticalSeverityPercentage"), 64)
+	if err != nil {
+		return true
+	}
+
+	severity, err := message.severity()
+	if err != nil {
+		d.logger().WithError(err).Warn("Unable to calculate alarm severity, treating alarm as critical")
+		return true
+	}
+	d.logger().Infof("Alarm (%s) severity is %.2f%% over the threshold", message.AlarmName, severity)
+	return severity >= criticalSeverity
+}
+
+// severity returns how far, as a percentage of the threshold, the datapoint that triggered the alarm was over the threshold.
+func (m Message) severity() (float64, error) {
+	matches := datapointRegexp.FindStringSubmatch(m.NewStateReason)
+	if len(matches) < 2 {
+		return 0, errors.Errorf("no datapoint found in state reason (%s)", m.NewStateReason)
+	}
+	datapoint, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to parse datapoint")
+	}
+
+	threshold := float64(m.Trigger.Threshold)
+	if threshold == 0 {
+		return 0, errors.New("alarm threshold is zero")
+	}
+	if strings.HasPrefix(m.Trigger.ComparisonOperator, "LessThan") {
+		return (threshold - datapoint) / threshold * 100, nil
+	}
+	return (datapoint - threshold) / threshold * 100, nil
+}
+
+// deferScaling stores the scaling action so that it is executed when the next maintenance window opens. It returns
+// false when the maintenance window is already open and the scaling should proceed immediately.
+func (d *DBInstance) deferScaling(newClass, alarmName string) (bool, error) {
+	window := d.getMaintenanceWindow()
+	if window == "" {
+		return false, errors.New("no maintenance window configured or set on the DB cluster")
+	}
+
+	now := time.Now().UTC()
+	start, end, err := nextMaintenanceWindow(window, now)
+	if err != nil {
+		return false, err
+	}
+	if !start.After(now) {
+		d.stepLogger("deferScaling").Infof("Maintenance window (%s) is open, proceeding with vertical scaling", window)
+		return false, nil
+	}
+
+	added, err := d.addPendingAction(newClass, alarmName, window, start, end)
+	if err != nil {
+		return false, err
+	}
+	if !added {
+		return true, nil
+	}
+
+	d.stepLogger("deferScaling").Infof("DB instance (%s) vertical scaling to (%s) deferred to maintenance window starting at %s", d.DBInstanceIdentifier, newClass, start.Format(time.RFC3339))
+	err = d.sendMattermostNotification(newClass, fmt.Sprintf("Vertical scaling was deferred to the maintenance window starting at %s", start.Format(time.RFC3339)))
+	if err != nil {
+		d.stepLogger("deferScaling").WithError(err).Error("failed to send Mattermost notification")
+	}
+	return true, nil
+}
+
+// addPendingAction stores the scaling action to be executed in the maintenance window. It returns false when the DB
+// instance already has a pending action, which is kept.
+func (d *DBInstance) addPendingAction(newClass, alarmName, window string, start, end time.Time) (bool, error) {
+	added := false
+	err := updateState(func(state *State) error {
+		for _, action := range state.PendingActions {
+			if action.DBInstanceIdentifier == d.DBInstanceIdentifier {
+				d.stepLogger("addPendingAction").Infof("DB instance (%s) already has a deferred scaling action to (%s) at %s", d.DBInstanceIdentifier, action.NewClass, action.WindowStart.Format(time.RFC3339))
+				return nil
+			}
+		}
+
+		state.PendingActions = append(state.PendingActions, PendingAction{
+			DBInstanceIdentifier: d.DBInstanceIdentifier,
+			DBClusterIdentifier:  d.DBClusterIdentifier,
+			CurrentClass:         d.DBInstanceClass,
+			NewClass:             newClass,
+			AlarmName:            alarmName,
+			MaintenanceWindow:    window,
+			WindowStart:          start,
+			WindowEnd:            end,
+			CorrelationID:        d.CorrelationID,
+		})
+		added = true
+		return nil
+	})
+	return added, err
+}
+
+// processPendingActions executes the deferred scaling actions whose maintenance window is open. Actions whose window
+// was missed are moved to the next occurrence of the window.
+func processPendingActions() error {
+	now := time.Now().UTC()
+	var due []PendingAction
+	// The due actions stay in the state until they are executed, so that they are not lost when the run fails.
+	err := updateState(func(state *State) error {
+		var remaining []PendingAction
+		for _, action := range state.PendingActions {
+			if now.Before(action.WindowStart) {
+				remaining = append(remaining, action)
+				continue
+			}
+			if now.After(action.WindowEnd) {
+				start, end, err := nextMaintenanceWindow(action.MaintenanceWindow, now)
+				if err != nil {
+					return errors.Wrapf(err, "Failed to reschedule deferred scaling of DB instance (%s)", action.DBInstanceIdentifier)
+				}
+				if start.After(now) {
+					log.Warnf("Maintenance window for DB instance (%s) was missed, rescheduling to %s", action.DBInstanceIdentifier, start.Format(time.RFC3339))
+					action.WindowStart = start
+					action.WindowEnd = end
+					remaining = append(remaining, action)
+					continue
+				}
+			}
+			due = append(due, action)
+		}
+		state.PendingActions = append(remaining, due...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(due) == 0 {
+		return nil
+	}
+
+	clients, err := getAWSClients()
+	if err != nil {
+		return errors.Wrap(err, "Failed to initiate AWS Clients")
+	}
+
+	suppression, err := getScalingSuppression(clients.SSM, now)
+	if err != nil {
+		return errors.Wrap(err, "Failed to check if vertical scaling is suppressed")
+	}
+	if suppression != "" {
+		log.Warnf("%s. Keeping %d deferred scaling actions pending", suppression, len(due))
+		return nil
+	}
+
+	var failures []string
+	for _, action := range due {
+		err = executePendingAction(clients.RDS, clients.CloudWatch, action, false)
+		if err == nil {
+			err = replacePendingAction(action.DBInstanceIdentifier, nil)
+			if err != nil {
+				return errors.Wrapf(err, "Failed to remove deferred scaling of DB instance (%s) from state", action.DBInstanceIdentifier)
+			}
+			continue
+		}
+
+		if errors.Cause(err) != errScalingSuppressed {
+			log.WithError(err).Errorf("Failed to execute deferred scaling of DB instance (%s)", action.DBInstanceIdentifier)
+			failures = append(failures, fmt.Sprintf("%s: %s", action.DBInstanceIdentifier, err))
+		}
+		start, end, windowErr := nextMaintenanceWindow(action.MaintenanceWindow, action.WindowEnd)
+		if windowErr != nil {
+			return errors.Wrapf(windowErr, "Failed to reschedule deferred scaling of DB instance (%s)", action.DBInstanceIdentifier)
+		}
+		log.Warnf("Rescheduling deferred scaling of DB instance (%s) to %s", action.DBInstanceIdentifier, start.Format(time.RFC3339))
+		action.WindowStart = start
+		action.WindowEnd = end
+		err = replacePendingAction(action.DBInstanceIdentifier, &action)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to reschedule deferred scaling of DB instance (%s)", action.DBInstanceIdentifier)
+		}
+	}
+	if len(failures) > 0 {
+		return errors.Errorf("Failed to execute %d deferred scaling actions: %s", len(failures), strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// replacePendingAction removes the pending action of the DB instance from the state, adding the replacement when it
+// is not nil.
+func replacePendingAction(dbInstanceIdentifier string, replacement *PendingAction) error {
+	return updateState(func(state *State) error {
+		var actions []PendingAction
+		for _, action := range state.PendingActions {
+			if action.DBInstanceIdentifier != dbInstanceIdentifier {
+				actions = append(actions, action)
+			}
+		}
+		if replacement != nil {
+			actions = append(actions, *replacement)
+		}
+		state.PendingActions = actions
+		return nil
+	})
+}
+
+// errScalingSuppressed is returned by executePendingAction when scaling is suppressed for the DB cluster, so that the
+// caller keeps the action for a later run.
+var errScalingSuppressed = errors.New("vertical scaling is suppressed")
+
+// executePendingAction executes a deferred or approved scaling action, unless the DB instance class changed since the
+// action was planned. Actions that were not approved yet go through the approval check first.
+func executePendingAction(RDSClient *rds.RDS, cloudwatchClient *cloudwatch.CloudWatch, action PendingAction, approved bool) (err error) {
+	dbInstance := DBInstance{DBInstanceIdentifier: action.DBInstanceIdentifier, CorrelationID: action.CorrelationID}
+	var span trace.Span
+	dbInstance.Context, span = startSpan(context.Background(), "executePendingAction", "correlation_id", action.CorrelationID, "db.instance", action.DBInstanceIdentifier, "db.to_class", action.NewClass, "approved", strconv.FormatBool(approved))
+	defer func() {
+		endSpan(span, err)
+	}()
+	dbInstance.addLogFields(log.Fields{"alarm_name": action.AlarmName, "cluster": action.DBClusterIdentifier, "target_class": action.NewClass})
+
+	dbInstance.logger().Infof("Executing pending vertical scaling of DB instance (%s). Getting database information", dbInstance.DBInstanceIdentifier)
+	err = dbInstance.getDatabaseInfo(RDSClient)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to obtain DB instance (%s) information", dbInstance.DBInstanceIdentifier)
+	}
+
+	suppression, err := dbInstance.getClusterScalingSuppression(time.Now().UTC())
+	if err != nil {
+		return errors.Wrap(err, "Failed to check if vertical scaling is suppressed for the DB cluster")
+	}
+	if suppression != "" {
+		dbInstance.logger().Warnf("%s. Keeping pending scaling action", suppression)
+		if !approved {
+			err = dbInstance.sendMattermostSuppressedNotification(suppression)
+			if err != nil {
+				dbInstance.logger().WithError(err).Error("failed to send Mattermost notification")
+			}
+		}
+		return errors.Wrap(errScalingSuppressed, suppression)
+	}
+
+	if action.ServerlessV2 != nil {
+		return dbInstance.executeServerlessV2Action(RDSClient, cloudwatchClient, action, approved)
+	}
+
+	if dbInstance.DBInstanceClass != action.CurrentClass {
+		dbInstance.logger().Infof("DB instance (%s) class changed from (%s) to (%s) since the action was deferred, skipping", dbInstance.DBInstanceIdentifier, action.CurrentClass, dbInstance.DBInstanceClass)
+		return nil
+	}
+
+	if !dbInstance.getSetDBInstanceClass() {
+		return errors.New("Existing DB instance class not in the supported lists")
+	}
+
+	blocked, err := dbInstance.checkGuardrails(RDSClient, action.NewClass)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to check DB instance (%s) scaling guardrails", dbInstance.DBInstanceIdentifier)
+	}
+	if blocked == "" {
+		orderable, err := dbInstance.isClassOrderable(RDSClient, action.NewClass)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to validate DB instance (%s) new class", dbInstance.DBInstanceIdentifier)
+		}
+		if !orderable {
+			blocked = fmt.Sprintf("Class (%s) is no longer orderable for engine (%s) version (%s) in (%s)", action.NewClass, dbInstance.Engine, dbInstance.EngineVersion, dbInstance.ModifiedZone)
+		}
+	}
+	if blocked != "" {
+		dbInstance.logger().Warnf("%s. Blocking deferred scaling action", blocked)
+		err = dbInstance.sendMattermostBlockedNotification(action.NewClass, blocked)
+		if err != nil {
+			dbInstance.logger().WithError(err).Error("failed to send Mattermost alert")
+		}
+		return nil
+	}
+
+	if !approved {
+		approvalReason, err := dbInstance.getApprovalReason(action.NewClass)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to check if DB instance (%s) vertical scaling requires approval", dbInstance.DBInstanceIdentifier)
+		}
+		if approvalReason != "" {
+			return dbInstance.requestApproval(action.NewClass, action.AlarmName, approvalReason)
+		}
+	}
+
+	err = dbInstance.notifyScalingStarted(action.NewClass)
+	if err != nil {
+		dbInstance.logger().WithError(err).Error("failed to send Mattermost notification")
+	}
+
+	err = scaleDBInstance(RDSClient, cloudwatchClient, dbInstance, action.NewClass)
+	if err != nil {
+		return dbInstance.scalingFailed(err)
+	}
+	dbInstance.recordScaling(time.Now().UTC())
+
+	trigger := ScalingTriggerMaintenanceWindow
+	if action.AlarmName == ForecastAlarmName {
+		trigger = ScalingTriggerForecast
+	}
+	if approved {
+		trigger = ScalingTriggerApproval
+	}
+	err = dbInstance.publishScalingAction(action.NewClass, trigger)
+	if err != nil {
+		dbInstance.logger().WithError(err).Error("Failed to publish scaling action")
+	}
+
+	err = dbInstance.sendMattermostNotification(action.NewClass, "Pending vertical scaling was succesfully handled")
+	if err != nil {
+		dbInstance.logger().WithError(err).Error("failed to send Mattermost notification")
+	}
+	return nil
+}
+
+// nextMaintenanceWindow returns the start and end of the first occurrence of the weekly maintenance window that ends
+// after the given time. The window uses the RDS format ddd:hh24:mi-ddd:hh24:mi in UTC.
+func nextMaintenanceWindow(window string, after time.Time) (time.Time, time.Time, error) {
+	parts := strings.Split(strings.ToLower(window), "-")
+	if len(parts) != 2 {
+		return time.Time{}, time.Time{}, errors.Errorf("invalid maintenance window (%s)", window)
+	}
+	startOffset, err := parseWindowBoundary(parts[0])
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.Wrapf(err, "invalid maintenance window (%s)", window)
+	}
+	endOffset, err := parseWindowBoundary(parts[1])
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.Wrapf(err, "invalid maintenance window (%s)", window)
+	}
+	if endOffset <= startOffset {
+		endOffset += 7 * 24 * time.Hour
+	}
+
+	after = after.UTC()
+	day := time.Date(after.Year(), after.Month(), after.Day(), 0, 0, 0, 0, time.UTC)
+	weekStart := day.AddDate(0, 0, -int(day.Weekday()))
+	for _, week := range []int{-1, 0, 1} {
+		start := weekStart.AddDate(0, 0, 7*week).Add(startOffset)
+		end := weekStart.AddDate(0, 0, 7*week).Add(endOffset)
+		if end.After(after) {
+			return start, end, nil
+		}
+	}
+	return time.Time{}, time.Time{}, errors.Errorf("unable to find next occurrence of maintenance window (%s)", window)
+}
+
+// parseWindowBoundary returns the offset from the start of the week (Sunday 00:00 UTC) of a ddd:hh24:mi boundary.
+func parseWindowBoundary(boundary string) (time.Duration, error) {
+	fields := strings.Split(boundary, ":")
+	if len(fields) != 3 {
+		return 0, errors.Errorf("invalid boundary (%s)", boundary)
+	}
+	weekday, ok := weekdays[fields[0]]
+	if !ok {
+		return 0, errors.Errorf("invalid weekday (%s)", fields[0])
+	}
+	hour, err := strconv.Atoi(fields[1])
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, errors.Errorf("invalid hour (%s)", fields[1])
+	}
+	minute, err := strconv.Atoi(fields[2])
+	if err != nil || minute < 0 || minute > 59 {
+		return 0, errors.Errorf("invalid minute (%s)", fields[2])
+	}
+	return time.Duration(weekday)*24*time.Hour + time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWindowBoundary(t *testing.T) {
+	tests := []struct {
+		name     string
+		boundary string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{name: "start of the week", boundary: "sun:00:00", expected: 0},
+		{name: "monday", boundary: "mon:01:30", expected: 25*time.Hour + 30*time.Minute},
+		{name: "end of the week", boundary: "sat:23:59", expected: 6*24*time.Hour + 23*time.Hour + 59*time.Minute},
+		{name: "missing minute", boundary: "sun:01", wantErr: true},
+		{name: "invalid weekday", boundary: "abc:00:00", wantErr: true},
+		{name: "uppercase weekday", boundary: "SUN:00:00", wantErr: true},
+		{name: "invalid hour", boundary: "sun:aa:00", wantErr: true},
+		{name: "hour out of range", boundary: "sun:24:00", wantErr: true},
+		{name: "minute out of range", boundary: "sun:00:60", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			offset, err := parseWindowBoundary(test.boundary)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", offset)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if offset != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, offset)
+			}
+		})
+	}
+}
+
+func TestNextMaintenanceWindow(t *testing.T) {
+	date := func(day, hour, minute int) time.Time {
+		return time.Date(2026, time.October, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name          string
+		window        string
+		after         time.Time
+		expectedStart time.Time
+		expectedEnd   time.Time
+		wantErr       bool
+	}{
+		{
+			name:          "later in the week",
+			window:        "sun:05:00-sun:06:00",
+			after:         date(14, 12, 0),
+			expectedStart: date(18, 5, 0),
+			expectedEnd:   date(18, 6, 0),
+		},
+		{
+			name:          "same day before the window",
+			window:        "wed:13:00-wed:14:00",
+			after:         date(14, 12, 0),
+			expectedStart: date(14, 13, 0),
+			expectedEnd:   date(14, 14, 0),
+		},
+		{
+			name:          "inside the window",
+			window:        "wed:11:00-wed:13:00",
+			after:         date(14, 12, 0),
+			expectedStart: date(14, 11, 0),
+			expectedEnd:   date(14, 13, 0),
+		},
+		{
+			name:          "at the end of the window",
+			window:        "wed:11:00-wed:12:00",
+			after:         date(14, 12, 0),
+			expectedStart: date(21, 11, 0),
+			expectedEnd:   date(21, 12, 0),
+		},
+		{
+			name:          "window wrapping around the week",
+			window:        "sat:23:00-sun:01:00",
+			after:         date(18, 0, 30),
+			expectedStart: date(17, 23, 0),
+			expectedEnd:   date(18, 1, 0),
+		},
+		{
+			name:          "uppercase window",
+			window:        "Sun:05:00-Sun:06:00",
+			after:         date(14, 12, 0),
+			expectedStart: date(18, 5, 0),
+			expectedEnd:   date(18, 6, 0),
+		},
+		{
+			name:          "time in another zone",
+			window:        "wed:13:00-wed:14:00",
+			after:         date(14, 12, 0).In(time.FixedZone("UTC+2", 2*60*60)),
+			expectedStart: date(14, 13, 0),
+			expectedEnd:   date(14, 14, 0),
+		},
+		{name: "missing end", window: "sun:05:00", after: date(14, 12, 0), wantErr: true},
+		{name: "invalid start", window: "xyz:05:00-sun:06:00", after: date(14, 12, 0), wantErr: true},
+		{name: "invalid end", window: "sun:05:00-sun:25:00", after: date(14, 12, 0), wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start, end, err := nextMaintenanceWindow(test.window, test.after)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %s - %s", start, end)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !start.Equal(test.expectedStart) || !end.Equal(test.expectedEnd) {
+				t.Errorf("expected %s - %s, got %s - %s", test.expectedStart, test.expectedEnd, start, end)
+			}
+		})
+	}
+}
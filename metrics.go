@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+	log "github.com/sirupsen/logrus"
+)
+
+// MetricsJobName is the Pushgateway job the metrics of the one-shot runs are pushed to.
+const MetricsJobName = "cloud-db-factory-vertical-scaling"
+
+// metricDurationBuckets are the upper bounds (seconds) of the duration histograms, from a few seconds for failovers to
+// half an hour for resizes.
+var metricDurationBuckets = []float64{5, 15, 30, 60, 120, 300, 600, 900, 1200, 1800}
+
+// metricsRegistry holds the metrics of the scaling operations only, so that the Pushgateway does not get the metrics
+// of the Go runtime of a one-shot run.
+var metricsRegistry = prometheus.NewRegistry()
+
+// metrics are the metrics of the scaling operations.
+var metrics = struct {
+	MessagesReceived  prometheus.Counter
+	MessagesProcessed prometheus.Counter
+	MessagesFailed    prometheus.Counter
+	ScalingActions    *prometheus.CounterVec
+	Failovers         *prometheus.CounterVec
+	AlarmUpdates      prometheus.Counter
+	ResizeDuration    prometheus.Histogram
+	WaiterDuration    *prometheus.HistogramVec
+	FailoverDuration  prometheus.Histogram
+}{
+	MessagesReceived:  prometheus.NewCounter(prometheus.CounterOpts{Name: "vertical_scaling_messages_received_total", Help: "SQS messages received."}),
+	MessagesProcessed: prometheus.NewCounter(prometheus.CounterOpts{Name: "vertical_scaling_messages_processed_total", Help: "SQS messages processed and deleted."}),
+	MessagesFailed:    prometheus.NewCounter(prometheus.CounterOpts{Name: "vertical_scaling_messages_failed_total", Help: "SQS messages whose processing failed."}),
+	ScalingActions:    prometheus.NewCounterVec(prometheus.CounterOpts{Name: "vertical_scaling_actions_total", Help: "Scaling actions executed."}, []string{"cluster", "from_class", "to_class"}),
+	Failovers:         prometheus.NewCounterVec(prometheus.CounterOpts{Name: "vertical_scaling_failovers_total", Help: "DB cluster failovers initiated."}, []string{"cluster"}),
+	AlarmUpdates:      prometheus.NewCounter(prometheus.CounterOpts{Name: "vertical_scaling_alarm_updates_total", Help: "Cloudwatch alarms created or updated."}),
+	ResizeDuration:    prometheus.NewHistogram(prometheus.HistogramOpts{Name: "vertical_scaling_resize_duration_seconds", Help: "Duration of the DB instance class changes.", Buckets: metricDurationBuckets}),
+	WaiterDuration:    prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "vertical_scaling_waiter_duration_seconds", Help: "Time spent waiting for RDS resources.", Buckets: metricDurationBuckets}, []string{"waiter"}),
+	FailoverDuration:  prometheus.NewHistogram(prometheus.HistogramOpts{Name: "vertical_scaling_failover_duration_seconds", Help: "Duration of the DB cluster failovers.", Buckets: metricDurationBuckets}),
+}
+
+func init() {
+	metricsRegistry.MustRegister(
+		metrics.MessagesReceived,
+		metrics.MessagesProcessed,
+		metrics.MessagesFailed,
+		metrics.ScalingActions,
+		metrics.Failovers,
+		metrics.AlarmUpdates,
+		metrics.ResizeDuration,
+		metrics.WaiterDuration,
+		metrics.FailoverDuration,
+	)
+}
+
+// observeSince records the time elapsed since start in the histogram.
+func observeSince(observer prometheus.Observer, start time.Time) {
+	observer.Observe(time.Since(start).Seconds())
+}
+
+// startMetricsServer starts the HTTP server exposing the metrics on /metrics, listening on MetricsListenAddress.
+func startMetricsServer() *http.Server {
+	address := ":9090"
+	if os.Getenv("MetricsListenAddress") != "" {
+		address = os.Getenv("MetricsListenAddress")
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{ErrorLog: log.StandardLogger()}))
+	server := &http.Server{
+		Addr:         address,
+		Handler:      mux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		log.Infof("Exposing metrics on %s/metrics", address)
+		err := server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			log.WithError(err).Error("Metrics server failed")
+		}
+	}()
+	return server
+}
+
+// pushMetrics pushes the metrics of a one-shot run to the Pushgateway at PushgatewayURL, when it is set.
+func pushMetrics() error {
+	if os.Getenv("PushgatewayURL") == "" {
+		return nil
+	}
+
+	err := push.New(os.Getenv("PushgatewayURL"), MetricsJobName).
+		Gatherer(metricsRegistry).
+		Client(&http.Client{Timeout: 10 * time.Second}).
+		Push()
+	if err != nil {
+		return errors.Wrap(err, "failed to push metrics to Pushgateway")
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/pkg/errors"
+)
+
+// DBInstanceGravitonFamilies maps the Intel instance families with their Graviton equivalent.
+var DBInstanceGravitonFamilies = map[string]string{
+	"t3": "t4g",
+	"r5": "r6g",
+}
+
+// getGravitonEquivalentClass returns the Graviton class with the same family and size as the Intel class, or the
+// smallest Graviton class with at least the memory of the Intel class when there is no such class.
+func getGravitonEquivalentClass(class string) (string, error) {
+	family, ok := DBInstanceGravitonFamilies[getClassFamily(class)]
+	if !ok {
+		return "", errors.Errorf("no Graviton family mapped to the family of class (%s)", class)
+	}
+	equivalent := strings.Replace(class, "."+getClassFamily(class)+".", "."+family+".", 1)
+	if _, ok := DBInstanceGravitonClassMemory[equivalent]; ok {
+		return equivalent, nil
+	}
+
+	memory, err := getClassMemory(class)
+	if err != nil {
+		return "", err
+	}
+	for _, gravitonClass := range DBInstanceGravitonClasses {
+		gravitonMemory, err := getClassMemory(gravitonClass)
+		if err != nil {
+			return "", err
+		}
+		if gravitonMemory >= memory {
+			return gravitonClass, nil
+		}
+	}
+	return "", errors.Errorf("no Graviton class with the memory of class (%s)", class)
+}
+
+// migrateClassFamily returns the Graviton equivalent of the new Intel class when the policy migrates the DB cluster to
+// Graviton and the equivalent class is orderable for the engine version, otherwise the new class is kept.
+func (d *DBInstance) migrateClassFamily(client *rds.RDS, newClass string) (string, error) {
+	if !d.Policy.MigrateToGraviton || d.isArm() {
+		return newClass, nil
+	}
+
+	gravitonClass, err := getGravitonEquivalentClass(newClass)
+	if err != nil {
+		d.stepLogger("migrateClassFamily").WithError(err).Warnf("Keeping DB instance (%s) new class (%s)", d.DBInstanceIdentifier, newClass)
+		return newClass, nil
+	}
+	orderable, err := d.isClassOrderable(client, gravitonClass)
+	if err != nil {
+		return "", err
+	}
+	if !orderable {
+		d.stepLogger("migrateClassFamily").Warnf("Graviton class (%s) is not orderable for engine (%s) version (%s). Keeping DB instance (%s) new class (%s)", gravitonClass, d.Engine, d.EngineVersion, d.DBInstanceIdentifier, newClass)
+		return newClass, nil
+	}
+
+	d.stepLogger("migrateClassFamily").Infof("Migrating DB instance (%s) to Graviton class (%s) instead of (%s)", d.DBInstanceIdentifier, gravitonClass, newClass)
+	return gravitonClass, nil
+}
+
+// MigrationAlarmName is the alarm name of the migrations to Graviton waiting for approval.
+const MigrationAlarmName = "migrate-family"
+
+// migrateFamily moves the DB instance to the Graviton equivalent of its current class. Writers are migrated by
+// migrating a reader and failing over to it, so every member of a DB cluster has to be migrated in turn. Like the
+// automated scaling, the migration is refused while scaling is suppressed or when a guardrail blocks it, and waits for
+// approval when it needs one.
+func migrateFamily(dbInstanceIdentifier string, dryRun bool) error {
+	clients, err := getAWSClients()
+	if err != nil {
+		return errors.Wrap(err, "Failed to initiate AWS Clients")
+	}
+
+	now := time.Now().UTC()
+	suppression, err := getScalingSuppression(clients.SSM, now)
+	if err != nil {
+		return errors.Wrap(err, "Failed to check if vertical scaling is suppressed")
+	}
+	if suppression != "" {
+		return errors.Errorf("%s. DB instance (%s) is not migrated", suppression, dbInstanceIdentifier)
+	}
+
+	dbInstance := DBInstance{DBInstanceIdentifier: dbInstanceIdentifier}
+	dbInstance.logger().Infof("Migrating DB instance (%s) to Graviton. Getting database information", dbInstance.DBInstanceIdentifier)
+	err = dbInstance.getDatabaseInfo(clients.RDS)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to obtain DB instance (%s) information", dbInstance.DBInstanceIdentifier)
+	}
+	if dbInstance.isArm() {
+		dbInstance.logger().Infof("DB instance (%s) class (%s) is already Graviton, skipping", dbInstance.DBInstanceIdentifier, dbInstance.DBInstanceClass)
+		return nil
+	}
+
+	suppression, err = dbInstance.getClusterScalingSuppression(now)
+	if err != nil {
+		return errors.Wrap(err, "Failed to check if vertical scaling is suppressed for the DB cluster")
+	}
+	if suppression != "" {
+		return errors.Errorf("%s. DB instance (%s) is not migrated", suppression, dbInstance.DBInstanceIdentifier)
+	}
+	if !dbInstance.getSetDBInstanceClass() {
+		return errors.New("Existing DB instance class not in the supported lists")
+	}
+
+	newClass, err := getGravitonEquivalentClass(dbInstance.DBInstanceClass)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get DB instance (%s) Graviton class", dbInstance.DBInstanceIdentifier)
+	}
+	orderable, err := dbInstance.isClassOrderable(clients.RDS, newClass)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to validate DB instance (%s) Graviton class", dbInstance.DBInstanceIdentifier)
+	}
+	if !orderable {
+		return errors.Errorf("Graviton class (%s) is not orderable for engine (%s) version (%s)", newClass, dbInstance.Engine, dbInstance.EngineVersion)
+	}
+
+	blocked, err := dbInstance.checkGuardrails(clients.RDS, newClass)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to check DB instance (%s) scaling guardrails", dbInstance.DBInstanceIdentifier)
+	}
+	if blocked != "" {
+		return errors.Errorf("%s. DB instance (%s) is not migrated", blocked, dbInstance.DBInstanceIdentifier)
+	}
+
+	approvalReason, err := dbInstance.getApprovalReason(newClass)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to check if DB instance (%s) migration requires approval", dbInstance.DBInstanceIdentifier)
+	}
+
+	if dryRun {
+		dbInstance.logger().Infof("DB instance (%s) would be migrated from (%s) to (%s)", dbInstance.DBInstanceIdentifier, dbInstance.DBInstanceClass, newClass)
+		if approvalReason != "" {
+			dbInstance.logger().Infof("The migration would wait for approval: %s", approvalReason)
+		}
+		return nil
+	}
+
+	if approvalReason != "" {
+		err = dbInstance.requestApproval(newClass, MigrationAlarmName, approvalReason)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to request approval for DB instance (%s) migration", dbInstance.DBInstanceIdentifier)
+		}
+		dbInstance.logger().Info("Migration to Graviton is waiting for approval, the daemon executes it once approved")
+		return nil
+	}
+
+	err = dbInstance.notifyScalingStarted(newClass)
+	if err != nil {
+		dbInstance.logger().WithError(err).Error("failed to send Mattermost notification")
+	}
+
+	err = scaleDBInstance(clients.RDS, clients.CloudWatch, dbInstance, newClass)
+	if err != nil {
+		return dbInstance.scalingFailed(err)
+	}
+	dbInstance.recordScaling(time.Now().UTC())
+
+	err = dbInstance.publishScalingAction(newClass, ScalingTriggerMigration)
+	if err != nil {
+		dbInstance.logger().WithError(err).Error("Failed to publish scaling action")
+	}
+
+	err = dbInstance.sendMattermostNotification(newClass, "Migration to Graviton was succesfully handled")
+	if err != nil {
+		dbInstance.logger().WithError(err).Error("failed to send Mattermost notification")
+	}
+	return nil
+}
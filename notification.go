@@ -1,30 +1,23 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
-	"net/http"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	model "github.com/mattermost/mattermost-server/v5/model"
 	"github.com/pkg/errors"
 )
 
-func send(webhookURL string, payload model.CommandResponse) error {
-	marshalContent, _ := json.Marshal(payload)
-	var jsonStr = []byte(marshalContent)
-	req, err := http.NewRequest("POST", webhookURL, bytes.NewBuffer(jsonStr))
-	req.Header.Set("X-Custom-Header", "aws-sns")
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+func send(webhookURL string, payload model.IncomingWebhookRequest, retry bool) error {
+	marshalContent, err := json.Marshal(payload)
 	if err != nil {
-		return errors.Wrap(err, "failed tο send HTTP request")
+		return errors.Wrap(err, "failed to encode webhook payload")
 	}
-	defer resp.Body.Close()
-	return nil
+	return deliver(webhookURL, marshalContent, map[string]string{"X-Custom-Header": "aws-sns"}, retry)
 }
 
 func (d *DBInstance) sendMattermostNotification(class string, message string) error {
@@ -37,17 +30,186 @@ func (d *DBInstance) sendMattermostNotification(class string, message string) er
 			{Title: "UpgradedDBClass", Value: class, Short: true},
 			{Title: "IsClusterWriter", Value: strconv.FormatBool(d.IsClusterWriter), Short: true},
 			{Title: "Environment", Value: os.Getenv("Environment"), Short: true},
+			{Title: "CorrelationID", Value: d.CorrelationID, Short: true},
+			{Title: "ScalingPolicy", Value: d.Policy.String(), Short: false},
 		},
 	}
+	if d.Thread != nil {
+		attachment.Fields = append(attachment.Fields, d.getThreadSummaryFields()...)
+		return d.postThreadNotification(SeverityInfo, d.notificationData(NotificationKindScaled, message, class), "", attachment)
+	}
 
-	payload := model.CommandResponse{
-		Username:    "Database Factory",
-		IconURL:     "https://img.favpng.com/13/4/25/factory-logo-industry-computer-icons-png-favpng-BTgC49vrFrF2SmJZZywXwfL2s.jpg",
-		Attachments: []*model.SlackAttachment{attachment},
+	payload := newWebhookPayload(d.notificationData(NotificationKindScaled, message, class), "", attachment, d.Policy.NotificationChannel)
+	err := notify(SeverityInfo, payload)
+	if err != nil {
+		return errors.Wrap(err, "failed to send notification")
 	}
-	err := send(os.Getenv("MattermostNotificationsHook"), payload)
+	return nil
+}
+
+func (d *DBInstance) sendMattermostSuppressedNotification(reason string) error {
+	attachment := &model.SlackAttachment{
+		Color: "#FFA500",
+		Fields: []*model.SlackAttachmentField{
+			{Title: "Vertical scaling was suppressed", Short: false},
+			{Title: "Reason", Value: reason, Short: false},
+			{Title: "DBInstanceIdentifier", Value: d.DBInstanceIdentifier, Short: true},
+			{Title: "DBClusterIdentifier", Value: d.DBClusterIdentifier, Short: true},
+			{Title: "Environment", Value: os.Getenv("Environment"), Short: true},
+			{Title: "CorrelationID", Value: d.CorrelationID, Short: true},
+			{Title: "ScalingPolicy", Value: d.Policy.String(), Short: false},
+		},
+	}
+
+	data := d.notificationData(NotificationKindSuppressed, "Vertical scaling was suppressed", "")
+	data.Reason = reason
+	payload := newWebhookPayload(data, "", attachment, d.Policy.NotificationChannel)
+	err := notify(SeverityWarning, payload)
 	if err != nil {
-		return errors.Wrap(err, "failed tο send Mattermost request payload")
+		return errors.Wrap(err, "failed to send notification")
+	}
+	return nil
+}
+
+func (d *DBInstance) sendMattermostBlockedNotification(class, reason string) error {
+	attachment := &model.SlackAttachment{
+		Color: "#FF0000",
+		Fields: []*model.SlackAttachmentField{
+			{Title: "Vertical scaling was blocked by a guardrail and needs human review", Short: false},
+			{Title: "Reason", Value: reason, Short: false},
+			{Title: "DBInstanceIdentifier", Value: d.DBInstanceIdentifier, Short: true},
+			{Title: "DBClusterIdentifier", Value: d.DBClusterIdentifier, Short: true},
+			{Title: "CurrentDBClass", Value: d.DBInstanceClass, Short: true},
+			{Title: "RequestedDBClass", Value: class, Short: true},
+			{Title: "Environment", Value: os.Getenv("Environment"), Short: true},
+			{Title: "CorrelationID", Value: d.CorrelationID, Short: true},
+			{Title: "ScalingPolicy", Value: d.Policy.String(), Short: false},
+		},
+	}
+
+	data := d.notificationData(NotificationKindBlocked, "Vertical scaling was blocked by a guardrail and needs human review", class)
+	data.Reason = reason
+	payload := newWebhookPayload(data, "", attachment, "")
+	err := notify(SeverityCritical, payload)
+	if err != nil {
+		return errors.Wrap(err, "failed to send alert notification")
+	}
+	return nil
+}
+
+func (d *DBInstance) sendMattermostApprovalRequest(approval PendingApproval) error {
+	actionContext := func(decision string) map[string]interface{} {
+		return map[string]interface{}{
+			"approval_id": approval.ID,
+			"decision":    decision,
+			"token":       os.Getenv("ApprovalToken"),
+		}
+	}
+
+	attachment := &model.SlackAttachment{
+		Color: "#FFA500",
+		Fields: []*model.SlackAttachmentField{
+			{Title: "Vertical scaling requires approval", Short: false},
+			{Title: "Reason", Value: approval.Reason, Short: false},
+			{Title: "DBInstanceIdentifier", Value: d.DBInstanceIdentifier, Short: true},
+			{Title: "DBClusterIdentifier", Value: d.DBClusterIdentifier, Short: true},
+			{Title: "CurrentDBClass", Value: approval.Action.CurrentClass, Short: true},
+			{Title: "RequestedDBClass", Value: approval.Action.NewClass, Short: true},
+			{Title: "IsClusterWriter", Value: strconv.FormatBool(d.IsClusterWriter), Short: true},
+			{Title: "Environment", Value: os.Getenv("Environment"), Short: true},
+			{Title: "CorrelationID", Value: d.CorrelationID, Short: true},
+			{Title: "ExpiresAt", Value: approval.ExpiresAt.Format(time.RFC3339), Short: true},
+		},
+		Actions: []*model.PostAction{
+			{
+				Id:    "approve",
+				Type:  model.POST_ACTION_TYPE_BUTTON,
+				Name:  "Approve",
+				Style: "good",
+				Integration: &model.PostActionIntegration{
+					URL:     os.Getenv("ApprovalCallbackURL"),
+					Context: actionContext("approve"),
+				},
+			},
+			{
+				Id:    "reject",
+				Type:  model.POST_ACTION_TYPE_BUTTON,
+				Name:  "Reject",
+				Style: "danger",
+				Integration: &model.PostActionIntegration{
+					URL:     os.Getenv("ApprovalCallbackURL"),
+					Context: actionContext("reject"),
+				},
+			},
+		},
+	}
+
+	data := d.notificationData(NotificationKindApproval, "Vertical scaling requires approval", approval.Action.NewClass)
+	data.Reason = approval.Reason
+	data.Approval = approval
+	payload := newWebhookPayload(data, "", attachment, d.Policy.NotificationChannel)
+	err := notify(SeverityWarning, payload)
+	if err != nil {
+		return errors.Wrap(err, "failed to send approval notification")
+	}
+	return nil
+}
+
+func sendMattermostAlarmDriftNotification(drifts []AlarmDrift, fixed bool) error {
+	title := "Cloudwatch alarms drifted from the expected definitions"
+	if fixed {
+		title = "Drifted Cloudwatch alarms were reconciled"
+	}
+
+	fields := []*model.SlackAttachmentField{
+		{Title: title, Short: false},
+		{Title: "Environment", Value: os.Getenv("Environment"), Short: true},
+	}
+	for _, drift := range drifts {
+		value := strings.Join(drift.Changes, "\n")
+		if drift.Missing {
+			value = "Missing"
+		}
+		fields = append(fields, &model.SlackAttachmentField{Title: drift.AlarmName, Value: value, Short: false})
+	}
+
+	attachment := &model.SlackAttachment{
+		Color:  "#FFA500",
+		Fields: fields,
+	}
+
+	data := newNotificationData(NotificationKindAlarmDrift, title)
+	data.Drifts = drifts
+	payload := newWebhookPayload(data, "", attachment, "")
+	err := notify(SeverityWarning, payload)
+	if err != nil {
+		return errors.Wrap(err, "failed to send notification")
+	}
+	return nil
+}
+
+func sendMattermostAlarmSuppressionNotification(suppression AlarmSuppression, enabled bool) error {
+	title := fmt.Sprintf("Cloudwatch alarm actions disabled while the DB cluster warms up, until %s", suppression.EnableAt.Format(time.RFC3339))
+	if enabled {
+		title = "Warmup period is over, Cloudwatch alarm actions enabled"
+	}
+
+	attachment := &model.SlackAttachment{
+		Color: "#FFA500",
+		Fields: []*model.SlackAttachmentField{
+			{Title: title, Short: false},
+			{Title: "DBClusterIdentifier", Value: suppression.DBClusterIdentifier, Short: true},
+			{Title: "Environment", Value: os.Getenv("Environment"), Short: true},
+			{Title: "Alarms", Value: strings.Join(suppression.AlarmNames, ", "), Short: false},
+		},
+	}
+
+	data := newNotificationData(NotificationKindAlarmSuppression, title)
+	data.Suppression = suppression
+	payload := newWebhookPayload(data, "", attachment, "")
+	err := notify(SeverityWarning, payload)
+	if err != nil {
+		return errors.Wrap(err, "failed to send notification")
 	}
 	return nil
 }
@@ -62,14 +224,12 @@ func sendMattermostErrorNotification(errorMessage error, message string) error {
 		},
 	}
 
-	payload := model.CommandResponse{
-		Username:    "Database Factory",
-		IconURL:     "https://img.favpng.com/13/4/25/factory-logo-industry-computer-icons-png-favpng-BTgC49vrFrF2SmJZZywXwfL2s.jpg",
-		Attachments: []*model.SlackAttachment{attachment},
-	}
-	err := send(os.Getenv("MattermostAlertsHook"), payload)
+	data := newNotificationData(NotificationKindError, message)
+	data.Error = errorMessage.Error()
+	payload := newWebhookPayload(data, "", attachment, "")
+	err := notify(SeverityCritical, payload)
 	if err != nil {
-		return errors.Wrap(err, "failed tο send Mattermost error payload")
+		return errors.Wrap(err, "failed to send error notification")
 	}
 	return nil
 }
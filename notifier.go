@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	model "github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+// Severity is the severity of a notification, used to route it to the notifiers.
+type Severity int
+
+const (
+	// SeverityInfo is used for the notifications of successful and deferred scaling.
+	SeverityInfo Severity = iota
+	// SeverityWarning is used for suppressed scaling, approval requests, alarm drift and alarm warmup.
+	SeverityWarning
+	// SeverityCritical is used for failures and for scaling blocked by a guardrail, which need human review.
+	SeverityCritical
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityCritical:
+		return "critical"
+	default:
+		return "info"
+	}
+}
+
+func parseSeverity(value string) (Severity, error) {
+	switch strings.ToLower(value) {
+	case "info":
+		return SeverityInfo, nil
+	case "warning":
+		return SeverityWarning, nil
+	case "critical":
+		return SeverityCritical, nil
+	}
+	return SeverityInfo, errors.Errorf("unsupported severity (%s), supported severities are info, warning and critical", value)
+}
+
+// Notification is used to store a notification independently of the backend it is sent to. The Mattermost webhook
+// payload is kept as is, the other backends use the title and the fields.
+type Notification struct {
+	Severity      Severity
+	Title         string
+	Fields        []*model.SlackAttachmentField
+	CorrelationID string
+	Channel       string
+	Payload       model.IncomingWebhookRequest
+	// Threaded is true when the notification was already posted in the Mattermost thread of the scaling run.
+	Threaded bool
+	// NoRetry is true for the notifications posted while scaling, which are spooled right away when their delivery
+	// fails instead of holding up the scaling with retries.
+	NoRetry bool
+}
+
+// newNotification returns the notification of a Mattermost webhook payload, titled with its first field.
+func newNotification(severity Severity, payload model.IncomingWebhookRequest) Notification {
+	notification := Notification{Severity: severity, Title: payload.Text, Channel: payload.ChannelName, Payload: payload}
+	for _, attachment := range payload.Attachments {
+		for _, field := range attachment.Fields {
+			if notification.Title == "" && field.Value == nil {
+				notification.Title = field.Title
+				continue
+			}
+			if field.Title == "CorrelationID" {
+				notification.CorrelationID = fmt.Sprintf("%v", field.Value)
+			}
+			notification.Fields = append(notification.Fields, field)
+		}
+	}
+	return notification
+}
+
+// Text returns the title and the fields of the notification as plain text.
+func (n Notification) Text() string {
+	lines := []string{n.Title}
+	for _, field := range n.Fields {
+		lines = append(lines, fmt.Sprintf("%s: %v", field.Title, field.Value))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// withoutActions returns the notification without the interactive message actions. Only the Mattermost notifier can
+// handle them, and their context holds the ApprovalToken, which must not be sent to the other backends.
+func (n Notification) withoutActions() Notification {
+	var attachments []*model.SlackAttachment
+	for _, attachment := range n.Payload.Attachments {
+		copied := *attachment
+		copied.Actions = nil
+		attachments = append(attachments, &copied)
+	}
+	n.Payload.Attachments = attachments
+	return n
+}
+
+// Notifier is implemented by the notification backends.
+type Notifier interface {
+	Name() string
+	// MinSeverity is the lowest severity of the notifications sent with the notifier.
+	MinSeverity() Severity
+	Send(notification Notification) error
+}
+
+// configuredNotifiers are the notifiers the notifications are sent with. They are set once at startup by
+// configureNotifiers and default to Mattermost, so that a configuration error can still be reported.
+var configuredNotifiers = []Notifier{&mattermostNotifier{}}
+
+// configureNotifiers validates the notifiers configured in Notifiers and uses them for the notifications. It is called
+// once at startup, so that a misconfigured notifier stops the tool instead of failing every notification.
+func configureNotifiers() error {
+	notifiers, err := getNotifiers()
+	if err != nil {
+		return err
+	}
+	configuredNotifiers = notifiers
+	return nil
+}
+
+// getNotifiers returns the notifiers configured in Notifiers, a comma separated list of mattermost, slack, pagerduty,
+// opsgenie and webhook. Defaults to mattermost.
+func getNotifiers() ([]Notifier, error) {
+	names := []string{"mattermost"}
+	if os.Getenv("Notifiers") != "" {
+		names = strings.Split(os.Getenv("Notifiers"), ",")
+	}
+
+	var notifiers []Notifier
+	for _, name := range names {
+		var notifier Notifier
+		var err error
+		switch strings.TrimSpace(name) {
+		case "mattermost":
+			notifier = &mattermostNotifier{}
+		case "slack":
+			notifier, err = newSlackNotifier()
+		case "pagerduty":
+			notifier, err = newPagerDutyNotifier()
+		case "opsgenie":
+			notifier, err = newOpsgenieNotifier()
+		case "webhook":
+			notifier, err = newWebhookNotifier()
+		default:
+			err = errors.Errorf("unsupported notifier (%s)", name)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to configure notifier (%s)", name)
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	return notifiers, nil
+}
+
+// getMinSeverity returns the severity of the environment variable, or the default when it is not set.
+func getMinSeverity(env string, defaultSeverity Severity) (Severity, error) {
+	if os.Getenv(env) == "" {
+		return defaultSeverity, nil
+	}
+	return parseSeverity(os.Getenv(env))
+}
+
+// notify sends the Mattermost webhook payload with all the notifiers whose minimum severity it meets. A failing notifier
+// does not stop the others.
+func notify(severity Severity, payload model.IncomingWebhookRequest) error {
+	return sendNotification(newNotification(severity, payload))
+}
+
+func sendNotification(notification Notification) error {
+	var failures []string
+	for _, notifier := range configuredNotifiers {
+		if notification.Severity < notifier.MinSeverity() {
+			continue
+		}
+		sent := notification
+		if _, ok := notifier.(*mattermostNotifier); !ok {
+			sent = notification.withoutActions()
+		}
+		err := notifier.Send(sent)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", notifier.Name(), err))
+		}
+	}
+	if len(failures) > 0 {
+		return errors.Errorf("failed to send notification: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// postJSON posts the body as JSON with the headers, see deliver.
+func postJSON(url string, body interface{}, headers map[string]string, retry bool) error {
+	content, err := json.Marshal(body)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode request body")
+	}
+	return deliver(url, content, headers, retry)
+}
+
+// mattermostNotifier sends the notifications with the Mattermost incoming webhooks. The critical notifications are sent
+// with MattermostAlertsHook and the others with MattermostNotificationsHook.
+type mattermostNotifier struct{}
+
+func (m *mattermostNotifier) Name() string {
+	return "mattermost"
+}
+
+func (m *mattermostNotifier) MinSeverity() Severity {
+	return SeverityInfo
+}
+
+func (m *mattermostNotifier) Send(notification Notification) error {
+	if notification.Threaded {
+		return nil
+	}
+	hook := os.Getenv("MattermostNotificationsHook")
+	if notification.Severity == SeverityCritical {
+		hook = os.Getenv("MattermostAlertsHook")
+	}
+	return send(hook, notification.Payload, !notification.NoRetry)
+}
+
+// slackNotifier sends the notifications with a Slack incoming webhook, which accepts the Mattermost attachments.
+type slackNotifier struct {
+	webhookURL  string
+	minSeverity Severity
+}
+
+func newSlackNotifier() (*slackNotifier, error) {
+	if os.Getenv("SlackWebhookURL") == "" {
+		return nil, errors.New("SlackWebhookURL is not set")
+	}
+	minSeverity, err := getMinSeverity("SlackMinSeverity", SeverityInfo)
+	if err != nil {
+		return nil, err
+	}
+	return &slackNotifier{webhookURL: os.Getenv("SlackWebhookURL"), minSeverity: minSeverity}, nil
+}
+
+func (s *slackNotifier) Name() string {
+	return "slack"
+}
+
+func (s *slackNotifier) MinSeverity() Severity {
+	return s.minSeverity
+}
+
+func (s *slackNotifier) Send(notification Notification) error {
+	body := map[string]interface{}{
+		"username":    notification.Payload.Username,
+		"icon_url":    notification.Payload.IconURL,
+		"text":        notification.Payload.Text,
+		"attachments": notification.Payload.Attachments,
+	}
+	if os.Getenv("SlackChannel") != "" {
+		body["channel"] = os.Getenv("SlackChannel")
+	}
+	return postJSON(s.webhookURL, body, nil, !notification.NoRetry)
+}
+
+// PagerDutyEventsURL is the endpoint of the PagerDuty Events API v2.
+const PagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// pagerDutyNotifier triggers PagerDuty incidents with the Events API v2, by default only for critical notifications.
+// It only sends trigger events: the incidents are not resolved by a later successful run and have to be resolved in
+// PagerDuty once the failure was reviewed.
+type pagerDutyNotifier struct {
+	routingKey  string
+	minSeverity Severity
+}
+
+func newPagerDutyNotifier() (*pagerDutyNotifier, error) {
+	if os.Getenv("PagerDutyRoutingKey") == "" {
+		return nil, errors.New("PagerDutyRoutingKey is not set")
+	}
+	minSeverity, err := getMinSeverity("PagerDutyMinSeverity", SeverityCritical)
+	if err != nil {
+		return nil, err
+	}
+	return &pagerDutyNotifier{routingKey: os.Getenv("PagerDutyRoutingKey"), minSeverity: minSeverity}, nil
+}
+
+func (p *pagerDutyNotifier) Name() string {
+	return "pagerduty"
+}
+
+func (p *pagerDutyNotifier) MinSeverity() Severity {
+	return p.minSeverity
+}
+
+func (p *pagerDutyNotifier) Send(notification Notification) error {
+	details := make(map[string]interface{})
+	for _, field := range notification.Fields {
+		details[field.Title] = field.Value
+	}
+	event := map[string]interface{}{
+		"routing_key":  p.routingKey,
+		"event_action": "trigger",
+		"payload": map[string]interface{}{
+			"summary":        notification.Title,
+			"source":         TracingServiceName,
+			"severity":       notification.Severity.String(),
+			"component":      os.Getenv("Environment"),
+			"custom_details": details,
+		},
+	}
+	if notification.CorrelationID != "" {
+		event["dedup_key"] = notification.CorrelationID
+	}
+	return postJSON(PagerDutyEventsURL, event, nil, !notification.NoRetry)
+}
+
+// OpsgenieAlertsURL is the endpoint of the Opsgenie Alert API.
+const OpsgenieAlertsURL = "https://api.opsgenie.com/v2/alerts"
+
+// opsgenieNotifier creates Opsgenie alerts, by default only for critical notifications.
+type opsgenieNotifier struct {
+	apiKey      string
+	minSeverity Severity
+}
+
+func newOpsgenieNotifier() (*opsgenieNotifier, error) {
+	if os.Getenv("OpsgenieAPIKey") == "" {
+		return nil, errors.New("OpsgenieAPIKey is not set")
+	}
+	minSeverity, err := getMinSeverity("OpsgenieMinSeverity", SeverityCritical)
+	if err != nil {
+		return nil, err
+	}
+	return &opsgenieNotifier{apiKey: os.Getenv("OpsgenieAPIKey"), minSeverity: minSeverity}, nil
+}
+
+func (o *opsgenieNotifier) Name() string {
+	return "opsgenie"
+}
+
+func (o *opsgenieNotifier) MinSeverity() Severity {
+	return o.minSeverity
+}
+
+func (o *opsgenieNotifier) Send(notification Notification) error {
+	priority := map[Severity]string{SeverityInfo: "P5", SeverityWarning: "P3", SeverityCritical: "P1"}
+	details := make(map[string]string)
+	for _, field := range notification.Fields {
+		details[field.Title] = fmt.Sprintf("%v", field.Value)
+	}
+	alert := map[string]interface{}{
+		"message":     notification.Title,
+		"description": notification.Text(),
+		"priority":    priority[notification.Severity],
+		"source":      TracingServiceName,
+		"details":     details,
+	}
+	if notification.CorrelationID != "" {
+		alert["alias"] = notification.CorrelationID
+	}
+	url := OpsgenieAlertsURL
+	if os.Getenv("OpsgenieAPIURL") != "" {
+		url = strings.TrimSuffix(os.Getenv("OpsgenieAPIURL"), "/") + "/v2/alerts"
+	}
+	return postJSON(url, alert, map[string]string{"Authorization": "GenieKey " + o.apiKey}, !notification.NoRetry)
+}
+
+// webhookNotifier posts the notifications to a generic webhook. The body is the notification encoded as JSON, or the
+// text/template in WebhookNotifierTemplate executed with the notification.
+type webhookNotifier struct {
+	url         string
+	template    *template.Template
+	minSeverity Severity
+}
+
+func newWebhookNotifier() (*webhookNotifier, error) {
+	if os.Getenv("WebhookNotifierURL") == "" {
+		return nil, errors.New("WebhookNotifierURL is not set")
+	}
+	minSeverity, err := getMinSeverity("WebhookNotifierMinSeverity", SeverityInfo)
+	if err != nil {
+		return nil, err
+	}
+	notifier := &webhookNotifier{url: os.Getenv("WebhookNotifierURL"), minSeverity: minSeverity}
+	if os.Getenv("WebhookNotifierTemplate") != "" {
+		notifier.template, err = template.New("webhook").Parse(os.Getenv("WebhookNotifierTemplate"))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse WebhookNotifierTemplate")
+		}
+	}
+	return notifier, nil
+}
+
+func (w *webhookNotifier) Name() string {
+	return "webhook"
+}
+
+func (w *webhookNotifier) MinSeverity() Severity {
+	return w.minSeverity
+}
+
+func (w *webhookNotifier) Send(notification Notification) error {
+	if w.template == nil {
+		fields := make(map[string]interface{})
+		for _, field := range notification.Fields {
+			fields[field.Title] = field.Value
+		}
+		return postJSON(w.url, map[string]interface{}{
+			"severity":       notification.Severity.String(),
+			"title":          notification.Title,
+			"correlation_id": notification.CorrelationID,
+			"environment":    os.Getenv("Environment"),
+			"fields":         fields,
+		}, nil, !notification.NoRetry)
+	}
+
+	var body bytes.Buffer
+	err := w.template.Execute(&body, notification)
+	if err != nil {
+		return errors.Wrap(err, "failed to execute WebhookNotifierTemplate")
+	}
+	var content json.RawMessage = body.Bytes()
+	if !json.Valid(content) {
+		return errors.New("WebhookNotifierTemplate did not produce valid JSON")
+	}
+	return postJSON(w.url, content, nil, !notification.NoRetry)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	model "github.com/mattermost/mattermost-server/v5/model"
+)
+
+func TestNewNotification(t *testing.T) {
+	title := &model.SlackAttachmentField{Title: "Vertical scaling was suppressed"}
+	reason := &model.SlackAttachmentField{Title: "Reason", Value: "Scaling group (cluster-1) is in cooldown"}
+	correlationID := &model.SlackAttachmentField{Title: "CorrelationID", Value: "message-1"}
+	section := &model.SlackAttachmentField{Title: "Links"}
+
+	tests := []struct {
+		name                  string
+		payload               model.IncomingWebhookRequest
+		expectedTitle         string
+		expectedCorrelationID string
+		expectedFields        []*model.SlackAttachmentField
+	}{
+		{name: "empty payload"},
+		{
+			name:          "text only",
+			payload:       model.IncomingWebhookRequest{Text: "Fleet report"},
+			expectedTitle: "Fleet report",
+		},
+		{
+			name: "title field",
+			payload: model.IncomingWebhookRequest{ChannelName: "ops", Attachments: []*model.SlackAttachment{
+				{Fields: []*model.SlackAttachmentField{title, reason, correlationID}},
+			}},
+			expectedTitle:         "Vertical scaling was suppressed",
+			expectedCorrelationID: "message-1",
+			expectedFields:        []*model.SlackAttachmentField{reason, correlationID},
+		},
+		{
+			name: "text and title field",
+			payload: model.IncomingWebhookRequest{Text: "@here", Attachments: []*model.SlackAttachment{
+				{Fields: []*model.SlackAttachmentField{title, reason}},
+			}},
+			expectedTitle:  "@here",
+			expectedFields: []*model.SlackAttachmentField{title, reason},
+		},
+		{
+			name: "several attachments",
+			payload: model.IncomingWebhookRequest{Attachments: []*model.SlackAttachment{
+				{Fields: []*model.SlackAttachmentField{title, reason}},
+				{Fields: []*model.SlackAttachmentField{section, correlationID}},
+			}},
+			expectedTitle:         "Vertical scaling was suppressed",
+			expectedCorrelationID: "message-1",
+			expectedFields:        []*model.SlackAttachmentField{reason, section, correlationID},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			notification := newNotification(SeverityWarning, test.payload)
+			expected := Notification{
+				Severity:      SeverityWarning,
+				Title:         test.expectedTitle,
+				Fields:        test.expectedFields,
+				CorrelationID: test.expectedCorrelationID,
+				Channel:       test.payload.ChannelName,
+				Payload:       test.payload,
+			}
+			if !reflect.DeepEqual(notification, expected) {
+				t.Errorf("expected %+v, got %+v", expected, notification)
+			}
+		})
+	}
+}
+
+func TestApprovalTokenNotSentToSlack(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+	}))
+	defer server.Close()
+
+	os.Setenv("ApprovalToken", "approval-secret")
+	os.Setenv("ApprovalCallbackURL", "https://vertical-scaling.example.com/approval")
+	defer os.Unsetenv("ApprovalToken")
+	defer os.Unsetenv("ApprovalCallbackURL")
+	defer func(notifiers []Notifier) { configuredNotifiers = notifiers }(configuredNotifiers)
+	configuredNotifiers = []Notifier{&slackNotifier{webhookURL: server.URL, minSeverity: SeverityInfo}}
+
+	dbInstance := DBInstance{DBInstanceIdentifier: "db-1", DBClusterIdentifier: "cluster-1", DBInstanceClass: "db.r5.large"}
+	approval := PendingApproval{ID: "approval-1", Action: dbInstance.newPendingAction("db.r5.4xlarge", "db-1-memory"), Reason: "Class jump"}
+	err := dbInstance.sendMattermostApprovalRequest(approval)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(bodies) != 1 {
+		t.Fatalf("expected one Slack request, got %d", len(bodies))
+	}
+	if strings.Contains(bodies[0], "approval-secret") || strings.Contains(bodies[0], "integration") {
+		t.Errorf("the Slack payload contains the approval actions: %s", bodies[0])
+	}
+	if !strings.Contains(bodies[0], "Vertical scaling requires approval") {
+		t.Errorf("the Slack payload is missing the approval request: %s", bodies[0])
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/pkg/errors"
+)
+
+// getModifiedZone returns the availability zone of the DB instance whose class is modified. For a cluster writer this
+// is the reader upgraded to replace it, not the writer itself. The zone is kept for the rest of the run.
+func (d *DBInstance) getModifiedZone(client *rds.RDS) (string, error) {
+	if d.ModifiedZone != "" {
+		return d.ModifiedZone, nil
+	}
+	if d.isStandalone() || !d.IsClusterWriter {
+		(*d).ModifiedZone = d.AvailabilityZone
+		return d.ModifiedZone, nil
+	}
+
+	clusterMembers, err := d.getDBClusterMembers(client)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get DB cluster members")
+	}
+	members, err := d.getClusterMemberStates(client)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get DB cluster members state")
+	}
+	reader := d.selectFailoverReader(clusterMembers, members)
+	if reader == "" {
+		return "", errors.Errorf("DB cluster (%s) has no reader to replace the writer", d.DBClusterIdentifier)
+	}
+	databaseInstances, err := client.DescribeDBInstances(&rds.DescribeDBInstancesInput{DBInstanceIdentifier: aws.String(reader)})
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to describe DB instance (%s)", reader)
+	}
+	if len(databaseInstances.DBInstances) == 0 {
+		return "", errors.Errorf("DB instance (%s) not found", reader)
+	}
+	(*d).ModifiedZone = aws.StringValue(databaseInstances.DBInstances[0].AvailabilityZone)
+	return d.ModifiedZone, nil
+}
+
+// isClassOrderable returns true when the instance class can be ordered for the engine and engine version of the DB
+// instance, in the availability zone of the modified DB instance when it is known.
+func (d *DBInstance) isClassOrderable(client *rds.RDS, class string) (bool, error) {
+	availabilityZone, err := d.getModifiedZone(client)
+	if err != nil {
+		return false, err
+	}
+
+	var orderable bool
+	err = client.DescribeOrderableDBInstanceOptionsPages(&rds.DescribeOrderableDBInstanceOptionsInput{
+		Engine:          aws.String(d.Engine),
+		EngineVersion:   aws.String(d.EngineVersion),
+		DBInstanceClass: aws.String(class),
+	}, func(page *rds.DescribeOrderableDBInstanceOptionsOutput, lastPage bool) bool {
+		for _, option := range page.OrderableDBInstanceOptions {
+			if availabilityZone == "" || isAvailabilityZoneListed(option.AvailabilityZones, availabilityZone) {
+				orderable = true
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return false, errors.Wrapf(err, "unable to describe orderable DB instance options of class (%s)", class)
+	}
+	return orderable, nil
+}
+
+func isAvailabilityZoneListed(availabilityZones []*rds.AvailabilityZone, name string) bool {
+	for _, availabilityZone := range availabilityZones {
+		if aws.StringValue(availabilityZone.Name) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// getOrderableClass returns the first class of the ladder of the new class, starting at the new class, that is
+// orderable and allowed by the policy families. An empty string is returned when no class is orderable.
+func (d *DBInstance) getOrderableClass(client *rds.RDS, newClass string) (string, error) {
+	ladder, index := getClassLadder(newClass)
+	if index < 0 {
+		return "", errors.Errorf("class (%s) not in the supported lists", newClass)
+	}
+
+	for _, class := range ladder[index:] {
+		if !d.Policy.isFamilyAllowed(class) {
+			continue
+		}
+		orderable, err := d.isClassOrderable(client, class)
+		if err != nil {
+			return "", err
+		}
+		if orderable {
+			if class != newClass {
+				d.stepLogger("getOrderableClass").Warnf("Class (%s) is not orderable for engine (%s) version (%s) in (%s). Using the next orderable class (%s)", newClass, d.Engine, d.EngineVersion, d.ModifiedZone, class)
+			}
+			return class, nil
+		}
+	}
+	return "", nil
+}
+
+func (d *DBInstance) notOrderableReason(class string) string {
+	return fmt.Sprintf("No class from (%s) up is orderable for engine (%s) version (%s) in (%s)", class, d.Engine, d.EngineVersion, d.ModifiedZone)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/pkg/errors"
+)
+
+// getMaxConnectionsParameter returns the max_connections value of the DB parameter group of the DB instance, which is
+// either a number or a formula such as LEAST({DBInstanceClassMemory/9531392},5000). An empty string is returned when
+// the parameter group does not set max_connections.
+func getMaxConnectionsParameter(client *rds.RDS, dbInstanceIdentifier string) (string, error) {
+	databaseInstances, err := client.DescribeDBInstances(&rds.DescribeDBInstancesInput{DBInstanceIdentifier: aws.String(dbInstanceIdentifier)})
+	if err != nil {
+		return "", errors.Wrap(err, "unable to describe DB instance")
+	}
+	if len(databaseInstances.DBInstances) == 0 || len(databaseInstances.DBInstances[0].DBParameterGroups) == 0 {
+		return "", errors.Errorf("no DB parameter group found for DB instance (%s)", dbInstanceIdentifier)
+	}
+	parameterGroupName := databaseInstances.DBInstances[0].DBParameterGroups[0].DBParameterGroupName
+
+	var value string
+	err = client.DescribeDBParametersPages(&rds.DescribeDBParametersInput{DBParameterGroupName: parameterGroupName}, func(page *rds.DescribeDBParametersOutput, lastPage bool) bool {
+		for _, parameter := range page.Parameters {
+			if aws.StringValue(parameter.ParameterName) == "max_connections" {
+				value = aws.StringValue(parameter.ParameterValue)
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to describe DB parameter group (%s)", aws.StringValue(parameterGroupName))
+	}
+	return value, nil
+}
+
+// evaluateParameterFormula evaluates a DB parameter formula for the DB instance class. Formulas support numbers, the
+// DBInstanceClassMemory and DBInstanceVCPU variables, the + - * / operators, {} and () grouping and the GREATEST,
+// LEAST, SUM and log (base 2) functions.
+//
+// DBInstanceClassMemory is the memory of the class. RDS evaluates it with the memory left once the operating system
+// and the RDS processes have reserved theirs, which AWS does not publish, so the result is an approximation that is a
+// few percent too high for the formulas growing with the memory.
+func evaluateParameterFormula(formula string, spec DBInstanceClassSpec) (float64, error) {
+	evaluator := &formulaEvaluator{
+		input: strings.ReplaceAll(formula, " ", ""),
+		variables: map[string]float64{
+			"dbinstanceclassmemory": spec.Memory,
+			"dbinstancevcpu":        float64(spec.VCPU),
+		},
+	}
+	value, err := evaluator.expression()
+	if err != nil {
+		return 0, errors.Wrapf(err, "unable to evaluate formula (%s)", formula)
+	}
+	if evaluator.position != len(evaluator.input) {
+		return 0, errors.Errorf("unable to evaluate formula (%s): unexpected character at position %d", formula, evaluator.position)
+	}
+	return value, nil
+}
+
+type formulaEvaluator struct {
+	input     string
+	position  int
+	variables map[string]float64
+}
+
+func (e *formulaEvaluator) peek() byte {
+	if e.position < len(e.input) {
+		return e.input[e.position]
+	}
+	return 0
+}
+
+func (e *formulaEvaluator) expression() (float64, error) {
+	value, err := e.term()
+	if err != nil {
+		return 0, err
+	}
+	for e.peek() == '+' || e.peek() == '-' {
+		operator := e.peek()
+		e.position++
+		operand, err := e.term()
+		if err != nil {
+			return 0, err
+		}
+		if operator == '+' {
+			value += operand
+		} else {
+			value -= operand
+		}
+	}
+	return value, nil
+}
+
+func (e *formulaEvaluator) term() (float64, error) {
+	value, err := e.factor()
+	if err != nil {
+		return 0, err
+	}
+	for e.peek() == '*' || e.peek() == '/' {
+		operator := e.peek()
+		e.position++
+		operand, err := e.factor()
+		if err != nil {
+			return 0, err
+		}
+		if operator == '*' {
+			value *= operand
+		} else {
+			if operand == 0 {
+				return 0, errors.New("division by zero")
+			}
+			value /= operand
+		}
+	}
+	return value, nil
+}
+
+func (e *formulaEvaluator) factor() (float64, error) {
+	switch character := e.peek(); {
+	case character == '{' || character == '(':
+		closing := byte('}')
+		if character == '(' {
+			closing = ')'
+		}
+		e.position++
+		value, err := e.expression()
+		if err != nil {
+			return 0, err
+		}
+		if e.peek() != closing {
+			return 0, errors.Errorf("expected %c at position %d", closing, e.position)
+		}
+		e.position++
+		return value, nil
+	case character == '-':
+		e.position++
+		value, err := e.factor()
+		return -value, err
+	case character == '.' || unicode.IsDigit(rune(character)):
+		start := e.position
+		for e.position < len(e.input) && (e.input[e.position] == '.' || unicode.IsDigit(rune(e.input[e.position]))) {
+			e.position++
+		}
+		return strconv.ParseFloat(e.input[start:e.position], 64)
+	case unicode.IsLetter(rune(character)):
+		start := e.position
+		for e.position < len(e.input) && (unicode.IsLetter(rune(e.input[e.position])) || unicode.IsDigit(rune(e.input[e.position]))) {
+			e.position++
+		}
+		name := strings.ToLower(e.input[start:e.position])
+		if e.peek() == '(' {
+			return e.function(name)
+		}
+		value, ok := e.variables[name]
+		if !ok {
+			return 0, errors.Errorf("unsupported variable (%s)", e.input[start:e.position])
+		}
+		return value, nil
+	default:
+		return 0, errors.Errorf("unexpected character at position %d", e.position)
+	}
+}
+
+func (e *formulaEvaluator) function(name string) (float64, error) {
+	e.position++
+	var arguments []float64
+	for {
+		value, err := e.expression()
+		if err != nil {
+			return 0, err
+		}
+		arguments = append(arguments, value)
+		if e.peek() == ',' {
+			e.position++
+			continue
+		}
+		if e.peek() != ')' {
+			return 0, errors.Errorf("expected ) at position %d", e.position)
+		}
+		e.position++
+		break
+	}
+
+	switch name {
+	case "log":
+		if len(arguments) != 1 || arguments[0] <= 0 {
+			return 0, errors.New("log requires a single positive argument")
+		}
+		return math.Log2(arguments[0]), nil
+	case "greatest", "least", "sum":
+	default:
+		return 0, errors.Errorf("unsupported function (%s)", name)
+	}
+
+	result := arguments[0]
+	for _, argument := range arguments[1:] {
+		switch name {
+		case "greatest":
+			result = math.Max(result, argument)
+		case "least":
+			result = math.Min(result, argument)
+		case "sum":
+			result += argument
+		}
+	}
+	return result, nil
+}
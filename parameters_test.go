@@ -0,0 +1,56 @@
+package main
+
+import "testing"
+
+func TestEvaluateParameterFormula(t *testing.T) {
+	spec := DBInstanceClassSpec{Class: "db.r5.xlarge", Memory: 4 * 8187281408, VCPU: 4}
+
+	tests := []struct {
+		name     string
+		formula  string
+		expected float64
+		wantErr  bool
+	}{
+		{name: "number", formula: "5000", expected: 5000},
+		{name: "decimal", formula: "0.5", expected: 0.5},
+		{name: "variable", formula: "DBInstanceVCPU", expected: 4},
+		{name: "case insensitive variable", formula: "dbinstancevcpu", expected: 4},
+		{name: "operator precedence", formula: "2+3*4-6/2", expected: 11},
+		{name: "grouping", formula: "{DBInstanceVCPU*(2+1)}", expected: 12},
+		{name: "negation", formula: "-(2+3)*4", expected: -20},
+		{name: "spaces", formula: "LEAST( 10 , 2 )", expected: 2},
+		{name: "least", formula: "LEAST({DBInstanceClassMemory/8187281408},5000)", expected: 4},
+		{name: "greatest", formula: "GREATEST({log(DBInstanceClassMemory/805306368)*45},{log(DBInstanceClassMemory/8187281408)*1000})", expected: 2000},
+		{name: "sum", formula: "SUM(1,2,3)", expected: 6},
+		{name: "log", formula: "log(1024)", expected: 10},
+		{name: "division by zero", formula: "1/0", wantErr: true},
+		{name: "unclosed function", formula: "LEAST(1,2", wantErr: true},
+		{name: "unclosed brace", formula: "{1+2", wantErr: true},
+		{name: "mismatched grouping", formula: "{1+2)", wantErr: true},
+		{name: "unsupported function", formula: "AVG(1,2)", wantErr: true},
+		{name: "unsupported variable", formula: "DBInstanceStorage", wantErr: true},
+		{name: "log of zero", formula: "log(0)", wantErr: true},
+		{name: "log with two arguments", formula: "log(2,4)", wantErr: true},
+		{name: "missing operand", formula: "1+", wantErr: true},
+		{name: "trailing character", formula: "1)", wantErr: true},
+		{name: "empty", formula: "", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value, err := evaluateParameterFormula(test.formula, spec)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if value != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DB cluster tags which override the global scaling policy.
+const (
+	PolicyTagMaxClass            = "vertical-scaling:max-class"
+	PolicyTagMinClass            = "vertical-scaling:min-class"
+	PolicyTagAllowedFamilies     = "vertical-scaling:allowed-families"
+	PolicyTagCooldown            = "vertical-scaling:cooldown"
+	PolicyTagScaleDownEnabled    = "vertical-scaling:scale-down-enabled"
+	PolicyTagNotificationChannel = "vertical-scaling:notification-channel"
+	PolicyTagMonthlyBudget       = "vertical-scaling:monthly-budget"
+	PolicyTagMigrateToGraviton   = "vertical-scaling:migrate-to-graviton"
+)
+
+// ScalingPolicy is used to store the scaling policy of a DB cluster, which is the global policy merged with the cluster tags.
+type ScalingPolicy struct {
+	MaxClass            string        `json:"maxClass"`
+	MinClass            string        `json:"minClass"`
+	AllowedFamilies     []string      `json:"allowedFamilies"`
+	Cooldown            time.Duration `json:"cooldown"`
+	ScaleDownEnabled    bool          `json:"scaleDownEnabled"`
+	NotificationChannel string        `json:"notificationChannel"`
+	MonthlyBudget       float64       `json:"monthlyBudget"`
+	MigrateToGraviton   bool          `json:"migrateToGraviton"`
+}
+
+// getScalingPolicy returns the global scaling policy defined by the environment variables, overridden by the DB cluster tags.
+// Scale-down is enabled unless it is disabled globally or for the cluster.
+func getScalingPolicy(tags map[string]string) (ScalingPolicy, error) {
+	policy := ScalingPolicy{ScaleDownEnabled: true}
+	settings := []struct {
+		envVar string
+		tag    string
+		apply  func(value string) error
+	}{
+		{"MaxDBInstanceClass", PolicyTagMaxClass, func(value string) error {
+			if _, err := getClassMemory(value); err != nil {
+				return err
+			}
+			policy.MaxClass = value
+			return nil
+		}},
+		{"MinDBInstanceClass", PolicyTagMinClass, func(value string) error {
+			if _, err := getClassMemory(value); err != nil {
+				return err
+			}
+			policy.MinClass = value
+			return nil
+		}},
+		{"AllowedInstanceFamilies", PolicyTagAllowedFamilies, func(value string) error {
+			policy.AllowedFamilies = nil
+			for _, family := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' }) {
+				policy.AllowedFamilies = append(policy.AllowedFamilies, strings.ToLower(family))
+			}
+			return nil
+		}},
+		{"ScalingCooldown", PolicyTagCooldown, func(value string) error {
+			cooldown, err := time.ParseDuration(value)
+			if err != nil {
+				return err
+			}
+			policy.Cooldown = cooldown
+			return nil
+		}},
+		{"ScaleDownEnabled", PolicyTagScaleDownEnabled, func(value string) error {
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return err
+			}
+			policy.ScaleDownEnabled = enabled
+			return nil
+		}},
+		{"MattermostNotificationsChannel", PolicyTagNotificationChannel, func(value string) error {
+			policy.NotificationChannel = value
+			return nil
+		}},
+		{"MonthlyCostBudget", PolicyTagMonthlyBudget, func(value string) error {
+			budget, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return err
+			}
+			policy.MonthlyBudget = budget
+			return nil
+		}},
+		{"MigrateToGraviton", PolicyTagMigrateToGraviton, func(value string) error {
+			migrate, err := strconv.ParseBool(value)
+			if err != nil {
+				return err
+			}
+			policy.MigrateToGraviton = migrate
+			return nil
+		}},
+	}
+
+	for _, setting := range settings {
+		if value := os.Getenv(setting.envVar); value != "" {
+			if err := setting.apply(value); err != nil {
+				return policy, errors.Wrapf(err, "invalid %s environment variable (%s)", setting.envVar, value)
+			}
+		}
+		if value, ok := tags[setting.tag]; ok && value != "" {
+			if err := setting.apply(value); err != nil {
+				return policy, errors.Wrapf(err, "invalid %s tag (%s)", setting.tag, value)
+			}
+		}
+	}
+	return policy, nil
+}
+
+// String returns the human readable summary of the policy used in notifications.
+func (p ScalingPolicy) String() string {
+	var parts []string
+	if p.MinClass != "" {
+		parts = append(parts, fmt.Sprintf("min class %s", p.MinClass))
+	}
+	if p.MaxClass != "" {
+		parts = append(parts, fmt.Sprintf("max class %s", p.MaxClass))
+	}
+	if len(p.AllowedFamilies) > 0 {
+		parts = append(parts, fmt.Sprintf("families %s", strings.Join(p.AllowedFamilies, ",")))
+	}
+	if p.Cooldown > 0 {
+		parts = append(parts, fmt.Sprintf("cooldown %s", p.Cooldown))
+	}
+	if p.MonthlyBudget > 0 {
+		parts = append(parts, fmt.Sprintf("budget $%.0f/month", p.MonthlyBudget))
+	}
+	if p.MigrateToGraviton {
+		parts = append(parts, "migrate to graviton")
+	}
+	parts = append(parts, fmt.Sprintf("scale-down %t", p.ScaleDownEnabled))
+	return strings.Join(parts, ", ")
+}
+
+// applyToLadder returns the first class of the ladder, starting at the given index, that satisfies the min class and
+// the allowed families of the policy. The max class is enforced by the guardrails.
+func (p ScalingPolicy) applyToLadder(ladder []string, index int) (string, error) {
+	if p.MinClass != "" {
+		minMemory, err := getClassMemory(p.MinClass)
+		if err != nil {
+			return "", err
+		}
+		for index < len(ladder)-1 {
+			memory, err := getClassMemory(ladder[index])
+			if err != nil {
+				return "", err
+			}
+			if memory >= minMemory {
+				break
+			}
+			index++
+		}
+	}
+
+	for index < len(ladder)-1 && !p.isFamilyAllowed(ladder[index]) {
+		index++
+	}
+	if index >= len(ladder)-1 {
+		return "", errors.Errorf("Maximum instance size used. No class allowed by the policy left in the ladder")
+	}
+	return ladder[index], nil
+}
+
+func (p ScalingPolicy) isFamilyAllowed(class string) bool {
+	if len(p.AllowedFamilies) == 0 {
+		return true
+	}
+	for _, family := range p.AllowedFamilies {
+		if family == getClassFamily(class) {
+			return true
+		}
+	}
+	return false
+}
+
+// getClassFamily returns the family of an instance class, e.g. r6g for db.r6g.large.
+func getClassFamily(class string) string {
+	parts := strings.Split(class, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+	return parts[1]
+}
+
+// getClassLadder returns the ladder of the class, Intel or Graviton, and the index of the class in it. The index is -1
+// when the class is in neither ladder.
+func getClassLadder(class string) ([]string, int) {
+	ladder := DBInstanceClasses
+	if _, ok := DBInstanceGravitonClassMemory[class]; ok {
+		ladder = DBInstanceGravitonClasses
+	}
+	for i, ladderClass := range ladder {
+		if ladderClass == class {
+			return ladder, i
+		}
+	}
+	return ladder, -1
+}
+
+// getClassMemory returns the memory (bytes) of an instance class from either the Intel or the Graviton list.
+func getClassMemory(class string) (float64, error) {
+	memory, ok := DBInstanceClassMemory[class]
+	if !ok {
+		memory, ok = DBInstanceGravitonClassMemory[class]
+	}
+	if !ok {
+		return 0, errors.Errorf("class (%s) not in the supported lists", class)
+	}
+	return strconv.ParseFloat(memory, 64)
+}
+
+// getCooldownSuppression returns the reason scaling is suppressed when the scaling group was scaled within the policy cooldown.
+func (d *DBInstance) getCooldownSuppression(now time.Time) (string, error) {
+	cooldownEnd, err := d.getCooldownEnd(now)
+	if err != nil {
+		return "", err
+	}
+	if cooldownEnd.IsZero() {
+		return "", nil
+	}
+	return fmt.Sprintf("Scaling group (%s) was scaled at %s and is in cooldown for %s", d.scalingGroup(), cooldownEnd.Add(-d.Policy.Cooldown).Format(time.RFC3339), d.Policy.Cooldown), nil
+}
+
+// getCooldownEnd returns the end of the cooldown of the scaling group, or a zero time when it is not in cooldown.
+func (d *DBInstance) getCooldownEnd(now time.Time) (time.Time, error) {
+	if d.Policy.Cooldown == 0 {
+		return time.Time{}, nil
+	}
+
+	state, err := loadState()
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "failed to load state")
+	}
+	lastScaling, ok := state.LastScaling[d.scalingGroup()]
+	if ok && now.Sub(lastScaling) < d.Policy.Cooldown {
+		return lastScaling.Add(d.Policy.Cooldown), nil
+	}
+	return time.Time{}, nil
+}
+
+// recordScaling stores the time of the scaling so that the cooldown of the scaling group can be enforced.
+func (d *DBInstance) recordScaling(now time.Time) {
+	err := updateState(func(state *State) error {
+		if state.LastScaling == nil {
+			state.LastScaling = make(map[string]time.Time)
+		}
+		state.LastScaling[d.scalingGroup()] = now
+		return nil
+	})
+	if err != nil {
+		d.logger().WithError(err).Error("failed to update state, scaling time not recorded")
+	}
+}
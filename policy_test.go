@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestApplyToLadder(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   ScalingPolicy
+		ladder   []string
+		index    int
+		expected string
+		wantErr  bool
+	}{
+		{name: "default policy", ladder: DBInstanceClasses, index: 3, expected: "db.r5.xlarge"},
+		{name: "min class above the index", policy: ScalingPolicy{MinClass: "db.r5.2xlarge"}, ladder: DBInstanceClasses, index: 2, expected: "db.r5.2xlarge"},
+		{name: "min class below the index", policy: ScalingPolicy{MinClass: "db.r5.large"}, ladder: DBInstanceClasses, index: 4, expected: "db.r5.2xlarge"},
+		{name: "min class of the other ladder", policy: ScalingPolicy{MinClass: "db.r5.xlarge"}, ladder: DBInstanceGravitonClasses, index: 1, expected: "db.r6g.xlarge"},
+		{name: "allowed family", policy: ScalingPolicy{AllowedFamilies: []string{"r5"}}, ladder: DBInstanceClasses, index: 0, expected: "db.r5.large"},
+		{name: "allowed families and min class", policy: ScalingPolicy{MinClass: "db.t4g.large", AllowedFamilies: []string{"r6g"}}, ladder: DBInstanceGravitonClasses, index: 0, expected: "db.r6g.large"},
+		{name: "no allowed family in the ladder", policy: ScalingPolicy{AllowedFamilies: []string{"r6g"}}, ladder: DBInstanceClasses, index: 0, wantErr: true},
+		{name: "largest class", ladder: DBInstanceClasses, index: len(DBInstanceClasses) - 1, wantErr: true},
+		{name: "min class at the top of the ladder", policy: ScalingPolicy{MinClass: "db.r5.24xlarge"}, ladder: DBInstanceClasses, index: 2, wantErr: true},
+		{name: "unsupported min class", policy: ScalingPolicy{MinClass: "db.x1.large"}, ladder: DBInstanceClasses, index: 2, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			class, err := test.policy.applyToLadder(test.ladder, test.index)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", class)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if class != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, class)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// getMultitenantDBInstances returns all the DB instances whose identifier matches the RDSMultitenantDBInstanceNamePrefix.
+func getMultitenantDBInstances(client *rds.RDS) ([]*rds.DBInstance, error) {
+	var dbInstances []*rds.DBInstance
+	err := client.DescribeDBInstancesPages(&rds.DescribeDBInstancesInput{}, func(page *rds.DescribeDBInstancesOutput, lastPage bool) bool {
+		for _, dbInstance := range page.DBInstances {
+			if strings.Contains(aws.StringValue(dbInstance.DBInstanceIdentifier), os.Getenv("RDSMultitenantDBInstanceNamePrefix")) {
+				dbInstances = append(dbInstances, dbInstance)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to describe DB instances")
+	}
+	return dbInstances, nil
+}
+
+// reconcileAlarms compares the alarms of every multitenant DB instance with the alarms expected for its current class
+// and reports the missing and drifted ones. When fix is true the missing alarms are created and the drifted ones updated.
+func reconcileAlarms(fix bool) (err error) {
+	ctx, run := startSpan(context.Background(), "reconcileAlarms", "fix", strconv.FormatBool(fix))
+	defer func() {
+		endSpan(run, err)
+	}()
+
+	clients, err := getAWSClients()
+	if err != nil {
+		return errors.Wrap(err, "Failed to initiate AWS Clients")
+	}
+
+	dbInstances, err := getMultitenantDBInstances(clients.RDS)
+	if err != nil {
+		return errors.Wrap(err, "Failed to get multitenant DB instances")
+	}
+
+	log.Infof("Reconciling Cloudwatch alarms of %d multitenant DB instances", len(dbInstances))
+	var drifts []AlarmDrift
+	for _, dbInstance := range dbInstances {
+		identifier := aws.StringValue(dbInstance.DBInstanceIdentifier)
+		class := aws.StringValue(dbInstance.DBInstanceClass)
+		if _, err := getClassMemory(class); err != nil && class != DBInstanceClassServerless {
+			log.Warnf("DB instance (%s) class (%s) not in the supported lists, skipping", identifier, class)
+			continue
+		}
+
+		instanceDrifts, err := reconcileDBInstanceAlarms(ctx, log.WithField("instance", identifier), clients.RDS, clients.CloudWatch, identifier, class, fix)
+		drifts = append(drifts, instanceDrifts...)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to reconcile DB instance (%s) Cloudwatch alarms", identifier)
+		}
+	}
+
+	log.Infof("Found %d missing or drifted Cloudwatch alarms", len(drifts))
+	if len(drifts) > 0 {
+		err = sendMattermostAlarmDriftNotification(drifts, fix)
+		if err != nil {
+			log.WithError(err).Error("failed to send Mattermost notification")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,539 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/rds"
+	model "github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// ReportPeriods are the supported periods of the fleet report.
+var ReportPeriods = map[string]time.Duration{
+	"daily":  24 * time.Hour,
+	"weekly": 7 * 24 * time.Hour,
+}
+
+// FleetReport is used to store the digest of the multitenant DB instances and of the scaling actions of a period.
+type FleetReport struct {
+	Environment       string
+	Period            string
+	Start             time.Time
+	End               time.Time
+	Instances         []FleetReportInstance
+	Actions           []ScalingActionRecord
+	ClassDistribution map[string]int
+	MonthlyCost       float64
+	ActionsCostDelta  float64
+	ScaleDownSavings  float64
+}
+
+// FleetReportInstance is used to store the report of a multitenant DB instance. The Cloudwatch statistics cover the
+// ScaleDownLookback and ScaleDownClass is set when the DB instance is eligible for scale-down.
+type FleetReportInstance struct {
+	DBInstanceIdentifier string
+	DBClusterIdentifier  string
+	Class                string
+	ClassIndex           int
+	LadderSize           int
+	NearTop              bool
+	MonthlyCost          float64
+	MaxCPUUtilization    float64
+	MinFreeableMemory    float64
+	ScaleDownClass       string
+	MonthlySavings       float64
+}
+
+func getReportPeriod(name string) (time.Duration, error) {
+	period, ok := ReportPeriods[name]
+	if !ok {
+		return 0, errors.Errorf("unsupported report period (%s), supported periods are daily and weekly", name)
+	}
+	return period, nil
+}
+
+func getDurationEnv(env string, defaultValue time.Duration) (time.Duration, error) {
+	if os.Getenv(env) == "" {
+		return defaultValue, nil
+	}
+	value, err := time.ParseDuration(os.Getenv(env))
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to parse %s", env)
+	}
+	return value, nil
+}
+
+func getFloatEnv(env string, defaultValue float64) (float64, error) {
+	if os.Getenv(env) == "" {
+		return defaultValue, nil
+	}
+	value, err := strconv.ParseFloat(os.Getenv(env), 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to parse float64 from %s string", env)
+	}
+	return value, nil
+}
+
+// appendScalingHistory stores the scaling action in the scaling history, dropping the actions older than
+// ScalingHistoryRetention (default 90 days).
+func appendScalingHistory(record ScalingActionRecord) error {
+	retention, err := getDurationEnv("ScalingHistoryRetention", 90*24*time.Hour)
+	if err != nil {
+		return err
+	}
+	return updateState(func(state *State) error {
+		var history []ScalingActionRecord
+		for _, action := range state.ScalingHistory {
+			if time.Since(action.Time) <= retention {
+				history = append(history, action)
+			}
+		}
+		state.ScalingHistory = append(history, record)
+		return nil
+	})
+}
+
+// getMetricStatistic returns the statistic of the DB instance metric over the lookback, and false when there are no
+// datapoints.
+func getMetricStatistic(client *cloudwatch.CloudWatch, dbInstanceIdentifier, metricName, statistic string, lookback time.Duration) (float64, bool, error) {
+	end := time.Now().UTC()
+	output, err := client.GetMetricStatistics(&cloudwatch.GetMetricStatisticsInput{
+		Namespace:  aws.String("AWS/RDS"),
+		MetricName: aws.String(metricName),
+		Dimensions: []*cloudwatch.Dimension{{Name: aws.String("DBInstanceIdentifier"), Value: aws.String(dbInstanceIdentifier)}},
+		StartTime:  aws.Time(end.Add(-lookback)),
+		EndTime:    aws.Time(end),
+		Period:     aws.Int64(86400),
+		Statistics: []*string{aws.String(statistic)},
+	})
+	if err != nil {
+		return 0, false, errors.Wrapf(err, "unable to get DB instance (%s) %s statistics", dbInstanceIdentifier, metricName)
+	}
+	if len(output.Datapoints) == 0 {
+		return 0, false, nil
+	}
+
+	value := aws.Float64Value(output.Datapoints[0].Maximum)
+	if statistic == cloudwatch.StatisticMinimum {
+		value = aws.Float64Value(output.Datapoints[0].Minimum)
+	}
+	for _, datapoint := range output.Datapoints[1:] {
+		if statistic == cloudwatch.StatisticMinimum && aws.Float64Value(datapoint.Minimum) < value {
+			value = aws.Float64Value(datapoint.Minimum)
+		}
+		if statistic == cloudwatch.StatisticMaximum && aws.Float64Value(datapoint.Maximum) > value {
+			value = aws.Float64Value(datapoint.Maximum)
+		}
+	}
+	return value, true, nil
+}
+
+// setScaleDown sets the class the DB instance can be scaled down to, which is the previous class of its ladder, when
+// its max CPU utilization over the ScaleDownLookback (default 14 days) is below ScaleDownCPUPercentage (default 40) and
+// its min freeable memory would still be above ScaleDownFreeMemoryPercentage (default 25) of the smaller class memory.
+// DB instances whose scaling policy disables scale-down are never eligible.
+func (i *FleetReportInstance) setScaleDown(client *cloudwatch.CloudWatch, policy ScalingPolicy) error {
+	if i.ClassIndex <= 0 || !policy.ScaleDownEnabled {
+		return nil
+	}
+	lookback, err := getDurationEnv("ScaleDownLookback", 14*24*time.Hour)
+	if err != nil {
+		return err
+	}
+	cpuPercentage, err := getFloatEnv("ScaleDownCPUPercentage", 40)
+	if err != nil {
+		return err
+	}
+	memoryPercentage, err := getFloatEnv("ScaleDownFreeMemoryPercentage", 25)
+	if err != nil {
+		return err
+	}
+
+	maxCPU, ok, err := getMetricStatistic(client, i.DBInstanceIdentifier, "CPUUtilization", cloudwatch.StatisticMaximum, lookback)
+	if err != nil || !ok {
+		return err
+	}
+	minFreeableMemory, ok, err := getMetricStatistic(client, i.DBInstanceIdentifier, "FreeableMemory", cloudwatch.StatisticMinimum, lookback)
+	if err != nil || !ok {
+		return err
+	}
+	(*i).MaxCPUUtilization = maxCPU
+	(*i).MinFreeableMemory = minFreeableMemory
+
+	ladder, _ := getClassLadder(i.Class)
+	smallerClass := ladder[i.ClassIndex-1]
+	memory, err := getClassMemory(i.Class)
+	if err != nil {
+		return err
+	}
+	smallerMemory, err := getClassMemory(smallerClass)
+	if err != nil {
+		return err
+	}
+	if maxCPU >= cpuPercentage || minFreeableMemory-(memory-smallerMemory) <= smallerMemory*memoryPercentage/100 {
+		return nil
+	}
+
+	(*i).ScaleDownClass = smallerClass
+	price, err := getHourlyPrice(i.Class)
+	if err != nil {
+		return err
+	}
+	smallerPrice, err := getHourlyPrice(smallerClass)
+	if err != nil {
+		return err
+	}
+	(*i).MonthlySavings = (price - smallerPrice) * HoursPerMonth
+	return nil
+}
+
+// getReportScalingPolicy returns the scaling policy of the DB instance, read from the tags of its DB cluster, or of the
+// DB instance itself when it is standalone. The policies are cached by scaling group.
+func getReportScalingPolicy(client *rds.RDS, dbInstance *rds.DBInstance, policies map[string]ScalingPolicy) (ScalingPolicy, error) {
+	group, resource := aws.StringValue(dbInstance.DBInstanceIdentifier), aws.StringValue(dbInstance.DBInstanceArn)
+	if aws.StringValue(dbInstance.DBClusterIdentifier) != "" {
+		group = aws.StringValue(dbInstance.DBClusterIdentifier)
+		if policy, ok := policies[group]; ok {
+			return policy, nil
+		}
+		databaseClusters, err := client.DescribeDBClusters(&rds.DescribeDBClustersInput{DBClusterIdentifier: dbInstance.DBClusterIdentifier})
+		if err != nil {
+			return ScalingPolicy{}, errors.Wrap(err, "unable to describe the DB Cluster")
+		}
+		if len(databaseClusters.DBClusters) == 0 {
+			return ScalingPolicy{}, errors.Errorf("DB cluster (%s) not found", group)
+		}
+		resource = aws.StringValue(databaseClusters.DBClusters[0].DBClusterArn)
+	}
+
+	tags, err := client.ListTagsForResource(&rds.ListTagsForResourceInput{ResourceName: aws.String(resource)})
+	if err != nil {
+		return ScalingPolicy{}, errors.Wrapf(err, "unable to list the tags of (%s)", resource)
+	}
+	tagValues := make(map[string]string)
+	for _, tag := range tags.TagList {
+		tagValues[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	policy, err := getScalingPolicy(tagValues)
+	if err != nil {
+		return ScalingPolicy{}, errors.Wrapf(err, "unable to get the scaling policy of (%s)", group)
+	}
+	policies[group] = policy
+	return policy, nil
+}
+
+// generateFleetReport returns the report of the multitenant DB instances and of the scaling actions of the period.
+// The scaling actions are only the ones recorded in the ScalingHistory of the local state file, so actions executed by
+// other deployments of the tool, or with another StateFile, are not reported.
+func generateFleetReport(periodName string) (*FleetReport, error) {
+	period, err := getReportPeriod(periodName)
+	if err != nil {
+		return nil, err
+	}
+	topMargin := 2
+	if os.Getenv("ReportTopOfLadderMargin") != "" {
+		topMargin, err = strconv.Atoi(os.Getenv("ReportTopOfLadderMargin"))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse int from ReportTopOfLadderMargin string")
+		}
+	}
+
+	clients, err := getAWSClients()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to initiate AWS Clients")
+	}
+	dbInstances, err := getMultitenantDBInstances(clients.RDS)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get multitenant DB instances")
+	}
+
+	end := time.Now().UTC()
+	report := &FleetReport{
+		Environment:       os.Getenv("Environment"),
+		Period:            periodName,
+		Start:             end.Add(-period),
+		End:               end,
+		ClassDistribution: make(map[string]int),
+	}
+
+	policies := make(map[string]ScalingPolicy)
+	for _, dbInstance := range dbInstances {
+		instance := newFleetReportInstance(dbInstance)
+		report.ClassDistribution[instance.Class]++
+		if instance.ClassIndex < 0 {
+			report.Instances = append(report.Instances, instance)
+			continue
+		}
+		instance.NearTop = instance.ClassIndex >= instance.LadderSize-topMargin
+
+		price, err := getHourlyPrice(instance.Class)
+		if err != nil {
+			log.WithError(err).Warnf("DB instance (%s) monthly cost not estimated", instance.DBInstanceIdentifier)
+		}
+		count := 1.0
+		if aws.BoolValue(dbInstance.MultiAZ) {
+			count = 2
+		}
+		instance.MonthlyCost = price * count * HoursPerMonth
+		report.MonthlyCost += instance.MonthlyCost
+
+		policy, err := getReportScalingPolicy(clients.RDS, dbInstance, policies)
+		if err == nil {
+			err = instance.setScaleDown(clients.CloudWatch, policy)
+		}
+		if err != nil {
+			log.WithError(err).Warnf("DB instance (%s) scale-down eligibility not evaluated", instance.DBInstanceIdentifier)
+		}
+		report.ScaleDownSavings += instance.MonthlySavings
+		report.Instances = append(report.Instances, instance)
+	}
+
+	state, err := loadState()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load state")
+	}
+	for _, action := range state.ScalingHistory {
+		if action.Time.Before(report.Start) || action.Environment != report.Environment {
+			continue
+		}
+		report.Actions = append(report.Actions, action)
+		fromPrice, fromErr := getHourlyPrice(action.FromClass)
+		toPrice, toErr := getHourlyPrice(action.ToClass)
+		if fromErr == nil && toErr == nil {
+			report.ActionsCostDelta += (toPrice - fromPrice) * HoursPerMonth
+		}
+	}
+	return report, nil
+}
+
+func newFleetReportInstance(dbInstance *rds.DBInstance) FleetReportInstance {
+	class := aws.StringValue(dbInstance.DBInstanceClass)
+	ladder, index := getClassLadder(class)
+	return FleetReportInstance{
+		DBInstanceIdentifier: aws.StringValue(dbInstance.DBInstanceIdentifier),
+		DBClusterIdentifier:  aws.StringValue(dbInstance.DBClusterIdentifier),
+		Class:                class,
+		ClassIndex:           index,
+		LadderSize:           len(ladder),
+	}
+}
+
+func (r *FleetReport) sortedClasses() []string {
+	var classes []string
+	for class := range r.ClassDistribution {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	return classes
+}
+
+func (r *FleetReport) nearTopInstances() []string {
+	var instances []string
+	for _, instance := range r.Instances {
+		if instance.NearTop {
+			instances = append(instances, fmt.Sprintf("%s (%s, %d/%d)", instance.DBInstanceIdentifier, instance.Class, instance.ClassIndex+1, instance.LadderSize))
+		}
+	}
+	return instances
+}
+
+func (r *FleetReport) scaleDownInstances() []string {
+	var instances []string
+	for _, instance := range r.Instances {
+		if instance.ScaleDownClass != "" {
+			instances = append(instances, fmt.Sprintf("%s (%s → %s, saves $%.2f/month)", instance.DBInstanceIdentifier, instance.Class, instance.ScaleDownClass, instance.MonthlySavings))
+		}
+	}
+	return instances
+}
+
+func (r *FleetReport) actionLines() []string {
+	var actions []string
+	for _, action := range r.Actions {
+		actions = append(actions, fmt.Sprintf("%s %s: %s → %s (%s)", action.Time.Format(time.RFC3339), action.DBInstanceIdentifier, action.FromClass, action.ToClass, action.Trigger))
+	}
+	return actions
+}
+
+// markdown returns the report as a Markdown document.
+func (r *FleetReport) markdown() string {
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "# DB fleet %s scaling report (%s)\n\n", r.Period, r.Environment)
+	fmt.Fprintf(&buffer, "Period: %s to %s\n\n", r.Start.Format(time.RFC3339), r.End.Format(time.RFC3339))
+	fmt.Fprintf(&buffer, "- DB instances: %d\n", len(r.Instances))
+	fmt.Fprintf(&buffer, "- Estimated monthly cost: $%.2f\n", r.MonthlyCost)
+	fmt.Fprintf(&buffer, "- Monthly cost delta of the scaling actions: $%+.2f\n", r.ActionsCostDelta)
+	fmt.Fprintf(&buffer, "- Potential monthly savings of scale-downs: $%.2f\n", r.ScaleDownSavings)
+
+	fmt.Fprintf(&buffer, "\n## Class distribution\n\n| Class | DB instances |\n| --- | --- |\n")
+	for _, class := range r.sortedClasses() {
+		fmt.Fprintf(&buffer, "| %s | %d |\n", class, r.ClassDistribution[class])
+	}
+
+	sections := []struct {
+		title string
+		lines []string
+	}{
+		{"Scaling actions", r.actionLines()},
+		{"At or near the top of the ladder", r.nearTopInstances()},
+		{"Eligible for scale-down", r.scaleDownInstances()},
+	}
+	for _, section := range sections {
+		fmt.Fprintf(&buffer, "\n## %s\n\n", section.title)
+		if len(section.lines) == 0 {
+			fmt.Fprintf(&buffer, "None\n")
+		}
+		for _, line := range section.lines {
+			fmt.Fprintf(&buffer, "- %s\n", line)
+		}
+	}
+	return buffer.String()
+}
+
+// csv returns the report of the DB instances as CSV.
+func (r *FleetReport) csv() (string, error) {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	records := [][]string{{"environment", "db_instance", "db_cluster", "class", "class_index", "ladder_size", "near_top", "monthly_cost", "max_cpu_utilization", "min_freeable_memory_bytes", "scale_down_class", "monthly_savings"}}
+	for _, instance := range r.Instances {
+		records = append(records, []string{
+			r.Environment,
+			instance.DBInstanceIdentifier,
+			instance.DBClusterIdentifier,
+			instance.Class,
+			strconv.Itoa(instance.ClassIndex),
+			strconv.Itoa(instance.LadderSize),
+			strconv.FormatBool(instance.NearTop),
+			fmt.Sprintf("%.2f", instance.MonthlyCost),
+			fmt.Sprintf("%.2f", instance.MaxCPUUtilization),
+			fmt.Sprintf("%.0f", instance.MinFreeableMemory),
+			instance.ScaleDownClass,
+			fmt.Sprintf("%.2f", instance.MonthlySavings),
+		})
+	}
+	err := writer.WriteAll(records)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to write CSV")
+	}
+	return buffer.String(), nil
+}
+
+// write writes the report as Markdown and CSV files in the directory.
+func (r *FleetReport) write(directory string) error {
+	name := fmt.Sprintf("vertical-scaling-report-%s-%s-%s", r.Environment, r.Period, r.End.Format("2006-01-02"))
+	err := ioutil.WriteFile(filepath.Join(directory, name+".md"), []byte(r.markdown()), 0644)
+	if err != nil {
+		return errors.Wrap(err, "unable to write Markdown report")
+	}
+	content, err := r.csv()
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filepath.Join(directory, name+".csv"), []byte(content), 0644)
+	if err != nil {
+		return errors.Wrap(err, "unable to write CSV report")
+	}
+	log.Infof("Fleet report written to %s", filepath.Join(directory, name)+".{md,csv}")
+	return nil
+}
+
+func joinOrNone(lines []string) string {
+	if len(lines) == 0 {
+		return "None"
+	}
+	return strings.Join(lines, "\n")
+}
+
+func sendMattermostReportNotification(report *FleetReport) error {
+	var distribution []string
+	for _, class := range report.sortedClasses() {
+		distribution = append(distribution, fmt.Sprintf("%s: %d", class, report.ClassDistribution[class]))
+	}
+	title := fmt.Sprintf("DB fleet %s scaling report", report.Period)
+
+	attachment := &model.SlackAttachment{
+		Color: "#1E90FF",
+		Fields: []*model.SlackAttachmentField{
+			{Title: title, Short: false},
+			{Title: "Environment", Value: report.Environment, Short: true},
+			{Title: "DBInstances", Value: strconv.Itoa(len(report.Instances)), Short: true},
+			{Title: "EstimatedMonthlyCost", Value: fmt.Sprintf("$%.2f", report.MonthlyCost), Short: true},
+			{Title: "ScalingCostDelta", Value: fmt.Sprintf("$%+.2f/month", report.ActionsCostDelta), Short: true},
+			{Title: "ClassDistribution", Value: joinOrNone(distribution), Short: false},
+			{Title: fmt.Sprintf("ScalingActions (%d)", len(report.Actions)), Value: joinOrNone(report.actionLines()), Short: false},
+			{Title: "NearTopOfLadder", Value: joinOrNone(report.nearTopInstances()), Short: false},
+			{Title: fmt.Sprintf("EligibleForScaleDown (saves $%.2f/month)", report.ScaleDownSavings), Value: joinOrNone(report.scaleDownInstances()), Short: false},
+		},
+	}
+
+	data := newNotificationData(NotificationKindReport, title)
+	data.Report = report
+	payload := newWebhookPayload(data, "", attachment, os.Getenv("ReportChannel"))
+	err := notify(SeverityInfo, payload)
+	if err != nil {
+		return errors.Wrap(err, "failed to send report notification")
+	}
+	return nil
+}
+
+// runFleetReport generates the fleet report of the period, writes it in the output directory when it is set, and posts
+// it when post is true.
+func runFleetReport(periodName, outputDirectory string, post bool) error {
+	report, err := generateFleetReport(periodName)
+	if err != nil {
+		return err
+	}
+	if outputDirectory != "" {
+		err = report.write(outputDirectory)
+		if err != nil {
+			return err
+		}
+	}
+	if post {
+		err = sendMattermostReportNotification(report)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runScheduledReport runs the fleet report of the ReportSchedule period when the previous one is at least a period old.
+func runScheduledReport() error {
+	if os.Getenv("ReportSchedule") == "" {
+		return nil
+	}
+	period, err := getReportPeriod(os.Getenv("ReportSchedule"))
+	if err != nil {
+		return err
+	}
+
+	// The report is recorded first so that a failing report is not posted again on every poll.
+	due := false
+	err = updateState(func(state *State) error {
+		if time.Since(state.LastReport) < period {
+			return nil
+		}
+		due = true
+		state.LastReport = time.Now().UTC()
+		return nil
+	})
+	if err != nil || !due {
+		return err
+	}
+
+	log.Infof("Running scheduled %s fleet report", os.Getenv("ReportSchedule"))
+	return runFleetReport(os.Getenv("ReportSchedule"), os.Getenv("ReportOutputDir"), true)
+}
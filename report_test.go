@@ -0,0 +1,68 @@
+package main
+
+import "testing"
+
+func TestFleetReportCSV(t *testing.T) {
+	header := "environment,db_instance,db_cluster,class,class_index,ladder_size,near_top,monthly_cost,max_cpu_utilization,min_freeable_memory_bytes,scale_down_class,monthly_savings\n"
+
+	tests := []struct {
+		name     string
+		report   FleetReport
+		expected string
+	}{
+		{name: "no instances", report: FleetReport{Environment: "prod"}, expected: header},
+		{
+			name: "instances",
+			report: FleetReport{
+				Environment: "prod",
+				Instances: []FleetReportInstance{
+					{
+						DBInstanceIdentifier: "db-1",
+						DBClusterIdentifier:  "cluster-1",
+						Class:                "db.r5.large",
+						ClassIndex:           2,
+						LadderSize:           10,
+						MonthlyCost:          175.2,
+						MaxCPUUtilization:    12.345,
+						MinFreeableMemory:    8589934592,
+						ScaleDownClass:       "db.t3.large",
+						MonthlySavings:       65.7,
+					},
+					{
+						DBInstanceIdentifier: "db-2",
+						Class:                "db.r6g.16xlarge",
+						ClassIndex:           9,
+						LadderSize:           11,
+						NearTop:              true,
+						MonthlyCost:          4483.84,
+						MaxCPUUtilization:    91,
+						MinFreeableMemory:    1.5,
+					},
+				},
+			},
+			expected: header +
+				"prod,db-1,cluster-1,db.r5.large,2,10,false,175.20,12.35,8589934592,db.t3.large,65.70\n" +
+				"prod,db-2,,db.r6g.16xlarge,9,11,true,4483.84,91.00,2,,0.00\n",
+		},
+		{
+			name: "quoted values",
+			report: FleetReport{
+				Environment: "prod, eu",
+				Instances:   []FleetReportInstance{{DBInstanceIdentifier: `db-"1"`, Class: "db.r5.large"}},
+			},
+			expected: header + `"prod, eu","db-""1""",,db.r5.large,0,0,false,0.00,0.00,0,,0.00` + "\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			content, err := test.report.csv()
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if content != test.expected {
+				t.Errorf("expected\n%s\ngot\n%s", test.expected, content)
+			}
+		})
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/pkg/errors"
+)
+
+// DBInstanceClassServerless is the instance class of the Aurora Serverless v2 DB instances.
+const DBInstanceClassServerless = "db.serverless"
+
+// ServerlessV2ACUMemory is the memory (bytes) of an Aurora capacity unit.
+const ServerlessV2ACUMemory = 2147483648
+
+// ServerlessV2Capacity is used to store the ServerlessV2ScalingConfiguration of a DB cluster, in Aurora capacity units.
+type ServerlessV2Capacity rds.ServerlessV2ScalingConfiguration
+
+func (c ServerlessV2Capacity) String() string {
+	return fmt.Sprintf("%s (%g-%g ACU)", DBInstanceClassServerless, aws.Float64Value(c.MinCapacity), aws.Float64Value(c.MaxCapacity))
+}
+
+// describeServerlessV2DBCluster returns the DB cluster with its ServerlessV2ScalingConfiguration.
+func describeServerlessV2DBCluster(client *rds.RDS, dbClusterIdentifier string) (*rds.DBCluster, error) {
+	output, err := client.DescribeDBClusters(&rds.DescribeDBClustersInput{DBClusterIdentifier: aws.String(dbClusterIdentifier)})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to describe the DB Cluster")
+	}
+	if len(output.DBClusters) == 0 {
+		return nil, errors.New("list of DB Clusters empty")
+	}
+	return output.DBClusters[0], nil
+}
+
+// getServerlessV2Capacity returns the ServerlessV2ScalingConfiguration of the DB cluster, or nil when the DB cluster
+// has no Serverless v2 capacity configured.
+func getServerlessV2Capacity(client *rds.RDS, dbClusterIdentifier string) (*ServerlessV2Capacity, error) {
+	cluster, err := describeServerlessV2DBCluster(client, dbClusterIdentifier)
+	if err != nil {
+		return nil, err
+	}
+	return (*ServerlessV2Capacity)(cluster.ServerlessV2ScalingConfiguration), nil
+}
+
+// getServerlessV2ClassSpec returns the capacity of a Serverless v2 DB instance, which is the max capacity of its DB cluster.
+func getServerlessV2ClassSpec(client *rds.RDS, dbInstanceIdentifier, maxConnectionsParameter string) (DBInstanceClassSpec, error) {
+	databaseInstances, err := client.DescribeDBInstances(&rds.DescribeDBInstancesInput{DBInstanceIdentifier: aws.String(dbInstanceIdentifier)})
+	if err != nil {
+		return DBInstanceClassSpec{}, errors.Wrap(err, "unable to describe DB instance")
+	}
+	if len(databaseInstances.DBInstances) == 0 {
+		return DBInstanceClassSpec{}, errors.New("list of DB instances empty")
+	}
+	capacity, err := getServerlessV2Capacity(client, aws.StringValue(databaseInstances.DBInstances[0].DBClusterIdentifier))
+	if err != nil {
+		return DBInstanceClassSpec{}, err
+	}
+	if capacity == nil {
+		return DBInstanceClassSpec{}, errors.Errorf("DB instance (%s) is serverless but its DB cluster has no Serverless v2 capacity", dbInstanceIdentifier)
+	}
+
+	spec := DBInstanceClassSpec{
+		Class:  DBInstanceClassServerless,
+		Memory: aws.Float64Value(capacity.MaxCapacity) * ServerlessV2ACUMemory,
+	}
+	err = spec.setMaxConnections(maxConnectionsParameter)
+	return spec, err
+}
+
+// getServerlessV2MaxCapacityLimit returns the highest max capacity the tool scales a DB cluster to, set by
+// ServerlessV2MaxCapacity and defaulting to 128 ACU.
+func getServerlessV2MaxCapacityLimit() (float64, error) {
+	if os.Getenv("ServerlessV2MaxCapacity") == "" {
+		return 128, nil
+	}
+	limit, err := strconv.ParseFloat(os.Getenv("ServerlessV2MaxCapacity"), 64)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to parse float64 from ServerlessV2MaxCapacity string")
+	}
+	return limit, nil
+}
+
+// getServerlessV2ACUHourlyPrice returns the hourly price of an Aurora capacity unit, set by ServerlessV2ACUHourlyPrice
+// and defaulting to the Aurora PostgreSQL price of us-east-1.
+func getServerlessV2ACUHourlyPrice() (float64, error) {
+	if os.Getenv("ServerlessV2ACUHourlyPrice") == "" {
+		return 0.12, nil
+	}
+	price, err := strconv.ParseFloat(os.Getenv("ServerlessV2ACUHourlyPrice"), 64)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to parse float64 from ServerlessV2ACUHourlyPrice string")
+	}
+	return price, nil
+}
+
+func (d *DBInstance) isServerless() bool {
+	return d.DBInstanceClass == DBInstanceClassServerless
+}
+
+// getNewServerlessV2Capacity doubles the max capacity of the DB cluster, up to the ServerlessV2MaxCapacity limit. The
+// min capacity is kept: it is the floor the cluster scales down to when idle, so raising it would not add headroom
+// under load but would keep the cost of the larger capacity after the load is gone.
+func (d *DBInstance) getNewServerlessV2Capacity() (*ServerlessV2Capacity, error) {
+	if d.ServerlessV2 == nil {
+		return nil, errors.Errorf("DB cluster (%s) has no Serverless v2 capacity", d.DBClusterIdentifier)
+	}
+	limit, err := getServerlessV2MaxCapacityLimit()
+	if err != nil {
+		return nil, err
+	}
+	maxCapacity := aws.Float64Value(d.ServerlessV2.MaxCapacity)
+	if maxCapacity >= limit {
+		return nil, nil
+	}
+
+	newCapacity := &ServerlessV2Capacity{
+		MinCapacity: d.ServerlessV2.MinCapacity,
+		MaxCapacity: aws.Float64(maxCapacity * 2),
+	}
+	if *newCapacity.MaxCapacity > limit {
+		newCapacity.MaxCapacity = aws.Float64(limit)
+	}
+	d.stepLogger("getNewServerlessV2Capacity").Infof("New DB cluster Serverless v2 capacity (%s)", newCapacity)
+	return newCapacity, nil
+}
+
+// scaleServerlessV2 handles the scaling request of a Serverless v2 DB instance by raising the max capacity of its DB
+// cluster. The capacity change goes through the budget guardrail and the approval check. It needs neither a restart
+// nor a failover, so it is never deferred.
+func (d *DBInstance) scaleServerlessV2(SQSClient *sqs.SQS, RDSClient *rds.RDS, cloudwatchClient *cloudwatch.CloudWatch, message *sqs.ReceiveMessageOutput, alarmName string) error {
+	newCapacity, err := d.getNewServerlessV2Capacity()
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get DB cluster (%s) new Serverless v2 capacity", d.DBClusterIdentifier)
+	}
+	if newCapacity == nil {
+		return d.blockScaling(SQSClient, message, d.ServerlessV2.String(), "Serverless v2 max capacity is already at the ServerlessV2MaxCapacity limit")
+	}
+
+	blocked, err := d.checkServerlessV2Guardrails(RDSClient, newCapacity)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to check DB cluster (%s) scaling guardrails", d.DBClusterIdentifier)
+	}
+	if blocked != "" {
+		return d.blockScaling(SQSClient, message, newCapacity.String(), blocked)
+	}
+
+	approvalReason, err := d.getServerlessV2ApprovalReason(newCapacity)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to check if DB cluster (%s) Serverless v2 scaling requires approval", d.DBClusterIdentifier)
+	}
+	if approvalReason != "" {
+		err = d.requestServerlessV2Approval(newCapacity, alarmName, approvalReason)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to request approval for DB cluster (%s) Serverless v2 scaling", d.DBClusterIdentifier)
+		}
+		d.logger().Info("Serverless v2 scaling is waiting for approval, deleting SQS message")
+		err = deleteSQSMessage(SQSClient, message)
+		if err != nil {
+			return errors.Wrap(err, "failed to delete SQS message")
+		}
+		return nil
+	}
+
+	err = d.applyServerlessV2Capacity(RDSClient, cloudwatchClient, newCapacity, ScalingTriggerAlarm)
+	if err != nil {
+		return err
+	}
+
+	d.logger().Info("Serverless v2 scaling was successfully handled, deleting SQS message")
+	err = deleteSQSMessage(SQSClient, message)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete SQS message")
+	}
+
+	err = d.sendMattermostNotification(newCapacity.String(), "Serverless v2 scaling was succesfully handled")
+	if err != nil {
+		d.logger().WithError(err).Error("failed to send Mattermost notification")
+	}
+	return nil
+}
+
+// getServerlessV2ApprovalReason returns the reason the change to the new Serverless v2 capacity needs a human
+// approval, or an empty string when it can proceed. The change needs an approval when the new max capacity is more
+// than ApprovalJumpRatio times the current max capacity. There is no failover, so ApprovalForWriterFailover does not
+// apply.
+func (d *DBInstance) getServerlessV2ApprovalReason(capacity *ServerlessV2Capacity) (string, error) {
+	if !isApprovalEnabled() || os.Getenv("ApprovalJumpRatio") == "" {
+		return "", nil
+	}
+	if os.Getenv("ApprovalToken") == "" {
+		return "", errors.New("ApprovalToken must be set when ApprovalCallbackURL is set")
+	}
+
+	ratio, err := strconv.ParseFloat(os.Getenv("ApprovalJumpRatio"), 64)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to parse float64 from ApprovalJumpRatio string")
+	}
+	currentMax := aws.Float64Value(d.ServerlessV2.MaxCapacity)
+	newMax := aws.Float64Value(capacity.MaxCapacity)
+	if currentMax > 0 && newMax/currentMax > ratio {
+		return fmt.Sprintf("Serverless v2 max capacity %g ACU is %.1f times the current max capacity %g ACU", newMax, newMax/currentMax, currentMax), nil
+	}
+	return "", nil
+}
+
+// requestServerlessV2Approval stores the capacity change and posts an interactive message asking for its approval.
+func (d *DBInstance) requestServerlessV2Approval(capacity *ServerlessV2Capacity, alarmName, reason string) error {
+	action := d.newPendingAction(capacity.String(), alarmName)
+	action.CurrentClass = d.ServerlessV2.String()
+	action.ServerlessV2 = capacity
+	return d.requestActionApproval(action, reason)
+}
+
+// applyServerlessV2Capacity changes the capacity of the DB cluster and updates the alarms of its serverless members.
+func (d *DBInstance) applyServerlessV2Capacity(RDSClient *rds.RDS, cloudwatchClient *cloudwatch.CloudWatch, newCapacity *ServerlessV2Capacity, trigger string) error {
+	currentCapacity := d.ServerlessV2.String()
+	err := d.changeServerlessV2Capacity(RDSClient, newCapacity)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to change DB cluster (%s) Serverless v2 capacity", d.DBClusterIdentifier)
+	}
+	metrics.ScalingActions.WithLabelValues(d.DBClusterIdentifier, currentCapacity, newCapacity.String()).Inc()
+
+	members, err := d.getClusterMemberStates(RDSClient)
+	if err != nil {
+		return errors.Wrap(err, "Failed to get DB cluster members state")
+	}
+	for identifier, member := range members {
+		if member.Class != DBInstanceClassServerless {
+			continue
+		}
+		d.logger().Infof("DB instance (%s) is a serverless %s. Updating Cloudwatch alarms", identifier, member.role())
+		_, err = reconcileDBInstanceAlarms(d.Context, d.stepLogger("updateAlarms"), RDSClient, cloudwatchClient, identifier, member.Class, true)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to update DB instance (%s) Cloudwatch alarms", identifier)
+		}
+	}
+	d.recordScaling(time.Now().UTC())
+
+	err = d.publishScalingAction(newCapacity.String(), trigger)
+	if err != nil {
+		d.logger().WithError(err).Error("Failed to publish scaling action")
+	}
+	return nil
+}
+
+// executeServerlessV2Action executes a capacity change waiting for approval, unless the capacity of the DB cluster
+// changed since the change was requested.
+func (d *DBInstance) executeServerlessV2Action(RDSClient *rds.RDS, cloudwatchClient *cloudwatch.CloudWatch, action PendingAction, approved bool) error {
+	if !d.isServerless() || d.ServerlessV2 == nil || d.ServerlessV2.String() != action.CurrentClass {
+		d.logger().Infof("DB cluster (%s) capacity changed from (%s) since the action was requested, skipping", d.DBClusterIdentifier, action.CurrentClass)
+		return nil
+	}
+
+	blocked, err := d.checkServerlessV2Guardrails(RDSClient, action.ServerlessV2)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to check DB cluster (%s) scaling guardrails", d.DBClusterIdentifier)
+	}
+	if blocked != "" {
+		d.logger().Warnf("%s. Blocking pending Serverless v2 scaling action", blocked)
+		err = d.sendMattermostBlockedNotification(action.NewClass, blocked)
+		if err != nil {
+			d.logger().WithError(err).Error("failed to send Mattermost alert")
+		}
+		return nil
+	}
+
+	if !approved {
+		approvalReason, err := d.getServerlessV2ApprovalReason(action.ServerlessV2)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to check if DB cluster (%s) Serverless v2 scaling requires approval", d.DBClusterIdentifier)
+		}
+		if approvalReason != "" {
+			return d.requestServerlessV2Approval(action.ServerlessV2, action.AlarmName, approvalReason)
+		}
+	}
+
+	trigger := ScalingTriggerMaintenanceWindow
+	if approved {
+		trigger = ScalingTriggerApproval
+	}
+	err = d.applyServerlessV2Capacity(RDSClient, cloudwatchClient, action.ServerlessV2, trigger)
+	if err != nil {
+		return err
+	}
+
+	err = d.sendMattermostNotification(action.NewClass, "Pending Serverless v2 scaling was succesfully handled")
+	if err != nil {
+		d.logger().WithError(err).Error("failed to send Mattermost notification")
+	}
+	return nil
+}
+
+func (d *DBInstance) changeServerlessV2Capacity(client *rds.RDS, capacity *ServerlessV2Capacity) error {
+	d.stepLogger("changeServerlessV2Capacity").Infof("Changing DB cluster (%s) capacity from (%s) to (%s)", d.DBClusterIdentifier, d.ServerlessV2, capacity)
+	_, span := startSpan(d.Context, "rds.ModifyDBCluster", "db.cluster", d.DBClusterIdentifier, "serverless_v2.max_capacity", fmt.Sprintf("%g", aws.Float64Value(capacity.MaxCapacity)))
+	_, err := client.ModifyDBCluster(&rds.ModifyDBClusterInput{
+		DBClusterIdentifier:              aws.String(d.DBClusterIdentifier),
+		ApplyImmediately:                 aws.Bool(true),
+		ServerlessV2ScalingConfiguration: (*rds.ServerlessV2ScalingConfiguration)(capacity),
+	})
+	endSpan(span, err)
+	if err != nil {
+		return errors.Wrap(err, "unable to modify DB cluster Serverless v2 capacity")
+	}
+
+	wait := 300
+	d.stepLogger("changeServerlessV2Capacity").Infof("Waiting up to %d seconds for DB cluster to apply the new capacity...", wait)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(wait)*time.Second)
+	defer cancel()
+	waitStart := time.Now()
+	_, span = startSpan(d.Context, "waitForServerlessV2Capacity", "db.cluster", d.DBClusterIdentifier)
+	err = d.waitForServerlessV2Capacity(ctx, client, capacity)
+	endSpan(span, err)
+	observeSince(metrics.WaiterDuration.WithLabelValues("serverless_capacity"), waitStart)
+	if err != nil {
+		return err
+	}
+	(*d).ServerlessV2 = capacity
+	return nil
+}
+
+func (d *DBInstance) waitForServerlessV2Capacity(ctx context.Context, client *rds.RDS, capacity *ServerlessV2Capacity) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "timed out waiting for DB cluster Serverless v2 capacity")
+		default:
+			cluster, err := describeServerlessV2DBCluster(client, d.DBClusterIdentifier)
+			if err != nil {
+				d.stepLogger("waitForServerlessV2Capacity").WithError(err).Error("unable to describe DB cluster")
+			} else if aws.StringValue(cluster.Status) == "available" && cluster.ServerlessV2ScalingConfiguration != nil &&
+				aws.Float64Value(cluster.ServerlessV2ScalingConfiguration.MaxCapacity) == aws.Float64Value(capacity.MaxCapacity) {
+				d.stepLogger("waitForServerlessV2Capacity").Infof("DB cluster (%s) capacity is (%s)", d.DBClusterIdentifier, (*ServerlessV2Capacity)(cluster.ServerlessV2ScalingConfiguration))
+				return nil
+			}
+
+			time.Sleep(5 * time.Second)
+		}
+	}
+}
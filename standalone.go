@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/pkg/errors"
+)
+
+// isStandalone returns true when the DB instance is a single-AZ or Multi-AZ RDS instance which does not belong to an
+// Aurora DB cluster.
+func (d *DBInstance) isStandalone() bool {
+	return d.DBClusterIdentifier == ""
+}
+
+// scalingGroup returns the identifier of the resource the DB instance is scaled with, which is the DB cluster, or the
+// DB instance itself when it is standalone. The cooldown and the alarm warmup are tracked per scaling group.
+func (d *DBInstance) scalingGroup() string {
+	if d.isStandalone() {
+		return d.DBInstanceIdentifier
+	}
+	return d.DBClusterIdentifier
+}
+
+// scalingGroupDimension returns the name of the Cloudwatch dimension of the scaling group, which is
+// DBInstanceIdentifier for standalone DB instances and DBClusterIdentifier otherwise.
+func (d *DBInstance) scalingGroupDimension() string {
+	if d.isStandalone() {
+		return "DBInstanceIdentifier"
+	}
+	return "DBClusterIdentifier"
+}
+
+// getStandaloneDatabaseInfo sets the information of a standalone DB instance. The maintenance window and the policy
+// tags are read from the DB instance itself.
+func (d *DBInstance) getStandaloneDatabaseInfo(client *rds.RDS, instance *rds.DBInstance) error {
+	(*d).MaintenanceWindow = aws.StringValue(instance.PreferredMaintenanceWindow)
+	(*d).MultiAZ = aws.BoolValue(instance.MultiAZ)
+
+	tags, err := client.ListTagsForResource(&rds.ListTagsForResourceInput{ResourceName: instance.DBInstanceArn})
+	if err != nil {
+		return errors.Wrap(err, "unable to list the DB instance tags")
+	}
+	(*d).ClusterTags = make(map[string]string)
+	for _, tag := range tags.TagList {
+		(*d).ClusterTags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+
+	(*d).Policy, err = getScalingPolicy(d.ClusterTags)
+	if err != nil {
+		return errors.Wrap(err, "unable to get the DB instance scaling policy")
+	}
+	return nil
+}
+
+// scaleStandaloneDBInstance changes the class of a standalone DB instance in place. For Multi-AZ instances RDS
+// modifies the standby first and fails over to it, which keeps the downtime to the failover.
+func scaleStandaloneDBInstance(RDSClient *rds.RDS, cloudwatchClient *cloudwatch.CloudWatch, dbInstance DBInstance, newClass string) error {
+	dbInstance.logger().Infof("DB instance (%s) is a standalone instance (Multi-AZ %t) with instance class (%s). Calling class upgrade", dbInstance.DBInstanceIdentifier, dbInstance.MultiAZ, dbInstance.DBInstanceClass)
+	err := dbInstance.changeDatabaseClass(RDSClient, newClass)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to change DB Instance (%s) class", dbInstance.DBInstanceIdentifier)
+	}
+	dbInstance.reportProgress(fmt.Sprintf("DB instance (%s) upgraded to class (%s)", dbInstance.DBInstanceIdentifier, newClass))
+
+	dbInstance.logger().Infof("DB instance (%s) has instance class (%s). Updating Cloudwatch alarms", dbInstance.DBInstanceIdentifier, newClass)
+	_, err = reconcileDBInstanceAlarms(dbInstance.Context, dbInstance.stepLogger("updateAlarms"), RDSClient, cloudwatchClient, dbInstance.DBInstanceIdentifier, newClass, true)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to update DB instance (%s) Cloudwatch alarms", dbInstance.DBInstanceIdentifier)
+	}
+
+	dbInstance.reportProgress("Cloudwatch alarms updated")
+	metrics.ScalingActions.WithLabelValues(dbInstance.scalingGroup(), dbInstance.DBInstanceClass, newClass).Inc()
+
+	members := map[string]ClusterMemberState{dbInstance.DBInstanceIdentifier: {Class: newClass, IsWriter: true}}
+	err = suppressAlarmsForWarmup(cloudwatchClient, dbInstance.scalingGroup(), members)
+	if err != nil {
+		dbInstance.warnWarmupSuppressionFailure(err)
+	}
+	return nil
+}
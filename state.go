@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// State is used to store work that has to be picked up by a later run of the tool.
+type State struct {
+	PendingActions           []PendingAction       `json:"pendingActions"`
+	PendingApprovals         []PendingApproval     `json:"pendingApprovals"`
+	AlarmSuppressions        []AlarmSuppression    `json:"alarmSuppressions"`
+	UndeliveredNotifications []SpooledNotification `json:"undeliveredNotifications"`
+	ScalingHistory           []ScalingActionRecord `json:"scalingHistory"`
+	LastScaling              map[string]time.Time  `json:"lastScaling"`
+	LastReport               time.Time             `json:"lastReport"`
+	LastForecast             time.Time             `json:"lastForecast"`
+}
+
+// getStateFilePath returns the StateFile. The default in the temporary directory is only suitable for single runs, the
+// daemon requires StateFile to be set.
+func getStateFilePath() string {
+	if os.Getenv("StateFile") != "" {
+		return os.Getenv("StateFile")
+	}
+	return filepath.Join(os.TempDir(), "cloud-db-factory-vertical-scaling-state.json")
+}
+
+// stateLock serializes the updates of the state file, which the daemon makes from the scaling loop, the scheduled
+// jobs and the approval endpoint.
+var stateLock sync.Mutex
+
+// updateState loads the state, applies the update and saves the state while holding the state lock. The state is not
+// saved when the update returns an error.
+func updateState(update func(state *State) error) error {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	state, err := loadState()
+	if err != nil {
+		return errors.Wrap(err, "failed to load state")
+	}
+	err = update(state)
+	if err != nil {
+		return err
+	}
+	err = state.save()
+	if err != nil {
+		return errors.Wrap(err, "failed to save state")
+	}
+	return nil
+}
+
+func loadState() (*State, error) {
+	var state State
+	content, err := ioutil.ReadFile(getStateFilePath())
+	if os.IsNotExist(err) {
+		return &state, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read state file")
+	}
+
+	err = json.Unmarshal(content, &state)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decode state file")
+	}
+	return &state, nil
+}
+
+func (s *State) save() error {
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "unable to encode state")
+	}
+
+	path := getStateFilePath()
+	err = ioutil.WriteFile(path+".tmp", content, 0600)
+	if err != nil {
+		return errors.Wrap(err, "unable to write state file")
+	}
+	err = os.Rename(path+".tmp", path)
+	if err != nil {
+		return errors.Wrap(err, "unable to replace state file")
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	model "github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultNotificationUsername is the username the notifications are posted with.
+	DefaultNotificationUsername = "Database Factory"
+	// DefaultNotificationIconURL is the icon the notifications are posted with.
+	DefaultNotificationIconURL = "https://img.favpng.com/13/4/25/factory-logo-industry-computer-icons-png-favpng-BTgC49vrFrF2SmJZZywXwfL2s.jpg"
+)
+
+// The kinds of notifications, used as the keys of the notification templates.
+const (
+	NotificationKindScaled           = "scaled"
+	NotificationKindSuppressed       = "suppressed"
+	NotificationKindBlocked          = "blocked"
+	NotificationKindApproval         = "approval"
+	NotificationKindAlarmDrift       = "alarm-drift"
+	NotificationKindAlarmSuppression = "alarm-suppression"
+	NotificationKindError            = "error"
+	NotificationKindScalingStarted   = "scaling-started"
+	NotificationKindScalingProgress  = "scaling-progress"
+	NotificationKindScalingFailed    = "scaling-failed"
+	NotificationKindReport           = "report"
+)
+
+// NotificationConfig is used to customise the branding and the wording of the notifications. It is loaded from the
+// JSON file NotificationTemplatesFile.
+type NotificationConfig struct {
+	Username  string                          `json:"username"`
+	IconURL   string                          `json:"iconURL"`
+	Templates map[string]NotificationTemplate `json:"templates"`
+}
+
+// NotificationTemplate is used to override a kind of notification. All the strings are Go text/templates executed
+// with the NotificationData of the notification. Empty attributes keep the defaults.
+type NotificationTemplate struct {
+	Color   string                      `json:"color"`
+	Text    string                      `json:"text"`
+	Title   string                      `json:"title"`
+	Channel string                      `json:"channel"`
+	Fields  []NotificationTemplateField `json:"fields"`
+}
+
+// NotificationTemplateField is used to define a field of a notification template, replacing the default fields.
+type NotificationTemplateField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+// NotificationData is the data the notification templates are executed with. Instance is the zero value for the
+// notifications which are not about a DB instance.
+type NotificationData struct {
+	Kind          string
+	Message       string
+	NewClass      string
+	Reason        string
+	Error         string
+	Environment   string
+	CorrelationID string
+	Time          time.Time
+	Instance      DBInstance
+	Approval      PendingApproval
+	Drifts        []AlarmDrift
+	Suppression   AlarmSuppression
+	Report        *FleetReport
+}
+
+// notificationData returns the data of a notification about the DB instance.
+func (d *DBInstance) notificationData(kind, message, newClass string) NotificationData {
+	return NotificationData{
+		Kind:          kind,
+		Message:       message,
+		NewClass:      newClass,
+		Environment:   os.Getenv("Environment"),
+		CorrelationID: d.CorrelationID,
+		Time:          time.Now().UTC(),
+		Instance:      *d,
+	}
+}
+
+// newNotificationData returns the data of a notification which is not about a DB instance.
+func newNotificationData(kind, message string) NotificationData {
+	return NotificationData{Kind: kind, Message: message, Environment: os.Getenv("Environment"), Time: time.Now().UTC()}
+}
+
+func loadNotificationConfig() (*NotificationConfig, error) {
+	config := &NotificationConfig{Username: DefaultNotificationUsername, IconURL: DefaultNotificationIconURL}
+	if os.Getenv("NotificationTemplatesFile") == "" {
+		return config, nil
+	}
+	content, err := ioutil.ReadFile(os.Getenv("NotificationTemplatesFile"))
+	if err != nil {
+		return config, errors.Wrap(err, "unable to read NotificationTemplatesFile")
+	}
+	err = json.Unmarshal(content, config)
+	if err != nil {
+		return &NotificationConfig{Username: DefaultNotificationUsername, IconURL: DefaultNotificationIconURL}, errors.Wrap(err, "unable to decode NotificationTemplatesFile")
+	}
+	if config.Username == "" {
+		config.Username = DefaultNotificationUsername
+	}
+	if config.IconURL == "" {
+		config.IconURL = DefaultNotificationIconURL
+	}
+	return config, nil
+}
+
+func executeNotificationTemplate(text string, data NotificationData) (string, error) {
+	tmpl, err := template.New("notification").Funcs(template.FuncMap{
+		"join":  strings.Join,
+		"upper": strings.ToUpper,
+	}).Parse(text)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to parse notification template (%s)", text)
+	}
+	var buffer bytes.Buffer
+	err = tmpl.Execute(&buffer, data)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to execute notification template (%s)", text)
+	}
+	return buffer.String(), nil
+}
+
+// render returns the attachment, text and channel with the template applied.
+func (t NotificationTemplate) render(data NotificationData, attachment *model.SlackAttachment, text, channel string) (*model.SlackAttachment, string, string, error) {
+	rendered := *attachment
+	var err error
+	if t.Color != "" {
+		rendered.Color = t.Color
+	}
+	if t.Text != "" {
+		text, err = executeNotificationTemplate(t.Text, data)
+		if err != nil {
+			return nil, "", "", err
+		}
+	}
+	if t.Channel != "" {
+		channel, err = executeNotificationTemplate(t.Channel, data)
+		if err != nil {
+			return nil, "", "", err
+		}
+	}
+
+	var title *model.SlackAttachmentField
+	fields := rendered.Fields
+	if len(fields) > 0 && fields[0].Value == nil {
+		title, fields = fields[0], fields[1:]
+	}
+	if t.Title != "" {
+		value, err := executeNotificationTemplate(t.Title, data)
+		if err != nil {
+			return nil, "", "", err
+		}
+		title = &model.SlackAttachmentField{Title: value, Short: false}
+	}
+	if t.Fields != nil {
+		fields = nil
+		for _, field := range t.Fields {
+			value, err := executeNotificationTemplate(field.Value, data)
+			if err != nil {
+				return nil, "", "", err
+			}
+			fields = append(fields, &model.SlackAttachmentField{Title: field.Title, Value: value, Short: model.SlackCompatibleBool(field.Short)})
+		}
+	}
+	rendered.Fields = fields
+	if title != nil {
+		rendered.Fields = append([]*model.SlackAttachmentField{title}, fields...)
+	}
+	return &rendered, text, channel, nil
+}
+
+// newWebhookPayload returns the webhook payload of the notification, branded and with the template of its kind
+// applied. Broken templates are logged and the default notification is sent, so that it is not lost.
+func newWebhookPayload(data NotificationData, text string, attachment *model.SlackAttachment, channel string) model.IncomingWebhookRequest {
+	config, err := loadNotificationConfig()
+	if err != nil {
+		log.WithError(err).Error("Failed to load notification templates, using the defaults")
+	}
+
+	if tmpl, ok := config.Templates[data.Kind]; ok {
+		if attachment == nil {
+			attachment = &model.SlackAttachment{}
+		}
+		rendered, renderedText, renderedChannel, err := tmpl.render(data, attachment, text, channel)
+		if err != nil {
+			log.WithError(err).Errorf("Failed to render the (%s) notification template, using the default", data.Kind)
+		} else {
+			attachment, text, channel = rendered, renderedText, renderedChannel
+		}
+	}
+
+	payload := model.IncomingWebhookRequest{
+		Text:        text,
+		Username:    config.Username,
+		IconURL:     config.IconURL,
+		ChannelName: channel,
+	}
+	if attachment != nil && (len(attachment.Fields) > 0 || len(attachment.Actions) > 0) {
+		payload.Attachments = []*model.SlackAttachment{attachment}
+	}
+	return payload
+}
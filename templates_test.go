@@ -0,0 +1,147 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	model "github.com/mattermost/mattermost-server/v5/model"
+)
+
+func TestNotificationTemplateRender(t *testing.T) {
+	data := NotificationData{
+		Kind:     NotificationKindSuppressed,
+		Message:  "Vertical scaling was suppressed",
+		Reason:   "Scaling group (cluster-1) is in cooldown",
+		Instance: DBInstance{DBInstanceIdentifier: "db-1"},
+	}
+	newAttachment := func() *model.SlackAttachment {
+		return &model.SlackAttachment{
+			Color: "#FFA500",
+			Fields: []*model.SlackAttachmentField{
+				{Title: "Vertical scaling was suppressed", Short: false},
+				{Title: "Reason", Value: data.Reason, Short: false},
+			},
+		}
+	}
+
+	tests := []struct {
+		name               string
+		template           NotificationTemplate
+		attachment         *model.SlackAttachment
+		expectedAttachment *model.SlackAttachment
+		expectedText       string
+		expectedChannel    string
+		wantErr            bool
+	}{
+		{
+			name:               "empty template",
+			attachment:         newAttachment(),
+			expectedAttachment: newAttachment(),
+			expectedText:       "text",
+			expectedChannel:    "channel",
+		},
+		{
+			name:       "color",
+			template:   NotificationTemplate{Color: "#000000"},
+			attachment: newAttachment(),
+			expectedAttachment: func() *model.SlackAttachment {
+				attachment := newAttachment()
+				attachment.Color = "#000000"
+				return attachment
+			}(),
+			expectedText:    "text",
+			expectedChannel: "channel",
+		},
+		{
+			name:               "text and channel",
+			template:           NotificationTemplate{Text: "@here {{.Instance.DBInstanceIdentifier}}", Channel: "alerts-{{.Kind}}"},
+			attachment:         newAttachment(),
+			expectedAttachment: newAttachment(),
+			expectedText:       "@here db-1",
+			expectedChannel:    "alerts-suppressed",
+		},
+		{
+			name:       "title",
+			template:   NotificationTemplate{Title: "{{upper .Kind}}: {{.Instance.DBInstanceIdentifier}}"},
+			attachment: newAttachment(),
+			expectedAttachment: &model.SlackAttachment{
+				Color: "#FFA500",
+				Fields: []*model.SlackAttachmentField{
+					{Title: "SUPPRESSED: db-1", Short: false},
+					{Title: "Reason", Value: data.Reason, Short: false},
+				},
+			},
+			expectedText:    "text",
+			expectedChannel: "channel",
+		},
+		{
+			name:       "title without a title field",
+			template:   NotificationTemplate{Title: "{{.Message}}"},
+			attachment: &model.SlackAttachment{Fields: []*model.SlackAttachmentField{{Title: "Reason", Value: data.Reason}}},
+			expectedAttachment: &model.SlackAttachment{
+				Fields: []*model.SlackAttachmentField{
+					{Title: "Vertical scaling was suppressed", Short: false},
+					{Title: "Reason", Value: data.Reason},
+				},
+			},
+			expectedText:    "text",
+			expectedChannel: "channel",
+		},
+		{
+			name: "fields",
+			template: NotificationTemplate{Fields: []NotificationTemplateField{
+				{Title: "Instance", Value: "{{.Instance.DBInstanceIdentifier}}", Short: true},
+				{Title: "Why", Value: "{{.Reason}}"},
+			}},
+			attachment: newAttachment(),
+			expectedAttachment: &model.SlackAttachment{
+				Color: "#FFA500",
+				Fields: []*model.SlackAttachmentField{
+					{Title: "Vertical scaling was suppressed", Short: false},
+					{Title: "Instance", Value: "db-1", Short: true},
+					{Title: "Why", Value: data.Reason, Short: false},
+				},
+			},
+			expectedText:    "text",
+			expectedChannel: "channel",
+		},
+		{
+			name:       "empty attachment",
+			template:   NotificationTemplate{Title: "{{.Message}}"},
+			attachment: &model.SlackAttachment{},
+			expectedAttachment: &model.SlackAttachment{
+				Fields: []*model.SlackAttachmentField{{Title: "Vertical scaling was suppressed", Short: false}},
+			},
+			expectedText:    "text",
+			expectedChannel: "channel",
+		},
+		{name: "invalid template", template: NotificationTemplate{Text: "{{.Message"}, attachment: newAttachment(), wantErr: true},
+		{name: "unknown attribute", template: NotificationTemplate{Title: "{{.Unknown}}"}, attachment: newAttachment(), wantErr: true},
+		{name: "invalid field", template: NotificationTemplate{Fields: []NotificationTemplateField{{Title: "Reason", Value: "{{join .Reason}}"}}}, attachment: newAttachment(), wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			original := *test.attachment
+			attachment, text, channel, err := test.template.render(data, test.attachment, "text", "channel")
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", attachment)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(attachment, test.expectedAttachment) {
+				t.Errorf("expected attachment %+v, got %+v", test.expectedAttachment, attachment)
+			}
+			if text != test.expectedText || channel != test.expectedChannel {
+				t.Errorf("expected text (%s) and channel (%s), got (%s) and (%s)", test.expectedText, test.expectedChannel, text, channel)
+			}
+			if !reflect.DeepEqual(*test.attachment, original) {
+				t.Errorf("the attachment was modified: %+v", test.attachment)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	model "github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+// NotificationThread is used to post the stages of a scaling run as replies to the post announcing the run. Without
+// the bot API the stages are not posted, they are only listed in the final notification of the run.
+type NotificationThread struct {
+	RootID     string
+	Started    time.Time
+	LastUpdate time.Time
+	Stages     []NotificationStage
+}
+
+// NotificationStage is used to store a completed stage of a scaling run and how long it took.
+type NotificationStage struct {
+	Name     string
+	Duration time.Duration
+}
+
+// isBotAPIEnabled returns true when the notifications can be posted with the bot API, which is required for threads.
+func isBotAPIEnabled() bool {
+	return os.Getenv("MattermostURL") != "" && os.Getenv("MattermostBotToken") != "" && os.Getenv("MattermostChannelID") != ""
+}
+
+func createBotPost(post *model.Post) (*model.Post, error) {
+	client := model.NewAPIv4Client(os.Getenv("MattermostURL"))
+	client.SetToken(os.Getenv("MattermostBotToken"))
+	post.ChannelId = os.Getenv("MattermostChannelID")
+	created, resp := client.CreatePost(post)
+	if resp != nil && resp.Error != nil {
+		return nil, errors.Wrap(resp.Error, "failed to create Mattermost post")
+	}
+	return created, nil
+}
+
+// postThreadNotification posts the attachment as a reply in the thread of the scaling run when the bot API is
+// enabled, otherwise it posts it with the notifications webhook. The other notifiers get it either way.
+func (d *DBInstance) postThreadNotification(severity Severity, data NotificationData, text string, attachment *model.SlackAttachment) error {
+	payload := newWebhookPayload(data, text, attachment, d.Policy.NotificationChannel)
+	threaded := isBotAPIEnabled()
+	if threaded {
+		post := &model.Post{Message: payload.Text}
+		if d.Thread != nil {
+			post.RootId = d.Thread.RootID
+		}
+		if len(payload.Attachments) > 0 {
+			post.AddProp("attachments", payload.Attachments)
+		}
+		created, err := createBotPost(post)
+		if err != nil {
+			return err
+		}
+		if d.Thread != nil && d.Thread.RootID == "" {
+			d.Thread.RootID = created.Id
+		}
+	}
+
+	notification := newNotification(severity, payload)
+	notification.Threaded = threaded
+	notification.NoRetry = data.Kind == NotificationKindScalingProgress
+	err := sendNotification(notification)
+	if err != nil {
+		return errors.Wrap(err, "failed to send notification")
+	}
+	return nil
+}
+
+// getScalingPlan returns how the DB instance is going to be scaled to the new class.
+func (d *DBInstance) getScalingPlan(newClass string) string {
+	switch {
+	case d.isStandalone() && d.MultiAZ:
+		return fmt.Sprintf("Modify the Multi-AZ DB instance to %s, RDS fails over to the modified standby", newClass)
+	case d.isStandalone():
+		return fmt.Sprintf("Modify the DB instance to %s in place", newClass)
+	case d.IsClusterWriter:
+		return fmt.Sprintf("Upgrade a reader to %s and fail over to it", newClass)
+	default:
+		return fmt.Sprintf("Modify the reader to %s in place, no failover", newClass)
+	}
+}
+
+// notifyScalingStarted announces the scaling run with its plan and starts its notification thread.
+func (d *DBInstance) notifyScalingStarted(newClass string) error {
+	now := time.Now()
+	(*d).Thread = &NotificationThread{Started: now, LastUpdate: now}
+
+	attachment := &model.SlackAttachment{
+		Color: "#1E90FF",
+		Fields: []*model.SlackAttachmentField{
+			{Title: "Vertical scaling started", Short: false},
+			{Title: "DBInstanceIdentifier", Value: d.DBInstanceIdentifier, Short: true},
+			{Title: "DBClusterIdentifier", Value: d.DBClusterIdentifier, Short: true},
+			{Title: "Class", Value: fmt.Sprintf("%s → %s", d.DBInstanceClass, newClass), Short: true},
+			{Title: "IsClusterWriter", Value: fmt.Sprintf("%t", d.IsClusterWriter), Short: true},
+			{Title: "Plan", Value: d.getScalingPlan(newClass), Short: false},
+			{Title: "Environment", Value: os.Getenv("Environment"), Short: true},
+			{Title: "CorrelationID", Value: d.CorrelationID, Short: true},
+		},
+	}
+	return d.postThreadNotification(SeverityInfo, d.notificationData(NotificationKindScalingStarted, d.getScalingPlan(newClass), newClass), "", attachment)
+}
+
+// notifyScalingProgress completes the current stage of the scaling run and posts it in the thread when the bot API is
+// enabled.
+func (d *DBInstance) notifyScalingProgress(stage string) error {
+	if d.Thread == nil {
+		return nil
+	}
+	now := time.Now()
+	d.Thread.Stages = append(d.Thread.Stages, NotificationStage{Name: stage, Duration: now.Sub(d.Thread.LastUpdate)})
+	d.Thread.LastUpdate = now
+
+	if !isBotAPIEnabled() {
+		return nil
+	}
+	return d.postThreadNotification(SeverityInfo, d.notificationData(NotificationKindScalingProgress, stage, ""), stage, nil)
+}
+
+// scalingFailed reports the failure of the scaling run and returns the error. With the bot API the failure is posted
+// in the thread of the run, otherwise the completed stages are added to the error, which the caller reports with the
+// error notification.
+func (d *DBInstance) scalingFailed(err error) error {
+	if d.Thread == nil {
+		return err
+	}
+	if !isBotAPIEnabled() {
+		return errors.Wrapf(err, "Completed stages (%s)", strings.Join(d.getStageDurations(), "; "))
+	}
+	notifyErr := d.notifyScalingFailed(err)
+	if notifyErr != nil {
+		d.logger().WithError(notifyErr).Error("failed to send Mattermost notification")
+	}
+	return err
+}
+
+// notifyScalingFailed posts the failure of the scaling run in its thread.
+func (d *DBInstance) notifyScalingFailed(err error) error {
+	if d.Thread == nil {
+		return nil
+	}
+	attachment := &model.SlackAttachment{
+		Color: "#FF0000",
+		Fields: []*model.SlackAttachmentField{
+			{Title: "Vertical scaling failed", Short: false},
+			{Title: "Error Message", Value: err.Error(), Short: false},
+			{Title: "Duration", Value: time.Since(d.Thread.Started).Round(time.Second).String(), Short: true},
+			{Title: "CorrelationID", Value: d.CorrelationID, Short: true},
+		},
+	}
+	data := d.notificationData(NotificationKindScalingFailed, "Vertical scaling failed", "")
+	data.Error = err.Error()
+	return d.postThreadNotification(SeverityWarning, data, "", attachment)
+}
+
+// getThreadSummaryFields returns the fields with the durations of the stages of the scaling run and the links to the
+// RDS console and the Cloudwatch alarms.
+func (d *DBInstance) getThreadSummaryFields() []*model.SlackAttachmentField {
+	if d.Thread == nil {
+		return nil
+	}
+
+	fields := []*model.SlackAttachmentField{{Title: "Durations", Value: strings.Join(d.getStageDurations(), "\n"), Short: false}}
+
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		return fields
+	}
+	resource, isCluster := d.DBInstanceIdentifier, false
+	if !d.isStandalone() {
+		resource, isCluster = d.DBClusterIdentifier, true
+	}
+	links := []string{
+		fmt.Sprintf("[RDS console](https://%s.console.aws.amazon.com/rds/home?region=%s#database:id=%s;is-cluster=%t)", region, region, resource, isCluster),
+		fmt.Sprintf("[Cloudwatch alarms](https://%s.console.aws.amazon.com/cloudwatch/home?region=%s#alarmsV2:?search=%s)", region, region, url.QueryEscape(d.DBInstanceIdentifier)),
+	}
+	return append(fields, &model.SlackAttachmentField{Title: "Links", Value: strings.Join(links, " · "), Short: false})
+}
+
+// getStageDurations returns the total duration of the scaling run followed by the durations of its completed stages.
+func (d *DBInstance) getStageDurations() []string {
+	stages := []string{fmt.Sprintf("Total: %s", time.Since(d.Thread.Started).Round(time.Second))}
+	for _, stage := range d.Thread.Stages {
+		stages = append(stages, fmt.Sprintf("%s: %s", stage.Name, stage.Duration.Round(time.Second)))
+	}
+	return stages
+}
+
+// reportProgress posts the stage in the thread of the scaling run, logging the failures so that they do not affect
+// the scaling.
+func (d *DBInstance) reportProgress(stage string) {
+	err := d.notifyScalingProgress(stage)
+	if err != nil {
+		d.logger().WithError(err).Error("failed to send Mattermost notification")
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingServiceName is the service.name resource attribute of the exported traces.
+const TracingServiceName = "cloud-db-factory-vertical-scaling"
+
+// tracerProvider is the provider of the configured TracesExporter, or nil when tracing is disabled. Without a
+// provider the spans are created by the no-op global provider, so the instrumented code does not need to check
+// whether tracing is enabled.
+var tracerProvider *sdktrace.TracerProvider
+
+// configureTracing sets the global tracer provider for the TracesExporter, which is otlp to send the traces to the
+// OTLP/HTTP endpoint OTEL_EXPORTER_OTLP_ENDPOINT, stdout to log them for local runs, or none.
+func configureTracing() error {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch os.Getenv("TracesExporter") {
+	case "", "none":
+		return nil
+	case "otlp":
+		exporter, err = otlptracehttp.New(context.Background())
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(log.StandardLogger().WriterLevel(log.InfoLevel)))
+	default:
+		return errors.Errorf("unsupported TracesExporter (%s), supported exporters are otlp, stdout and none", os.Getenv("TracesExporter"))
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to create the %s traces exporter", os.Getenv("TracesExporter"))
+	}
+
+	tracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", TracingServiceName),
+			attribute.String("deployment.environment", os.Getenv("Environment")),
+		)),
+	)
+	otel.SetTracerProvider(tracerProvider)
+	return nil
+}
+
+// startSpan starts a span whose parent is the span of the context, or the root span of a new trace when the context
+// has none. The attributes are given as key value pairs. A nil context is treated as an empty one, so that the DB
+// instances built outside of a run can still be traced.
+func startSpan(ctx context.Context, name string, attributes ...string) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return otel.Tracer(TracingServiceName).Start(ctx, name, trace.WithAttributes(spanAttributes(attributes...)...))
+}
+
+// spanAttributes returns the key value pairs as string attributes.
+func spanAttributes(attributes ...string) []attribute.KeyValue {
+	var keyValues []attribute.KeyValue
+	for i := 0; i+1 < len(attributes); i += 2 {
+		keyValues = append(keyValues, attribute.String(attributes[i], attributes[i+1]))
+	}
+	return keyValues
+}
+
+// endSpan ends the span, with an error status when err is not nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetStatus(codes.Ok, "")
+	}
+	span.End()
+}
+
+// flushTraces exports the ended spans with the TracesExporter.
+func flushTraces() error {
+	if tracerProvider == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := tracerProvider.ForceFlush(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to export traces")
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// AlarmSuppression is used to store the alarms whose actions were disabled while a DB cluster warms up after scaling.
+// Only the alarms whose actions were enabled before the scaling are stored, so that the alarms an operator disabled
+// stay disabled after the warmup period.
+type AlarmSuppression struct {
+	DBClusterIdentifier string    `json:"dbClusterIdentifier"`
+	AlarmNames          []string  `json:"alarmNames"`
+	EnableAt            time.Time `json:"enableAt"`
+}
+
+func getAlarmWarmupPeriod() (time.Duration, error) {
+	if os.Getenv("AlarmWarmupPeriod") == "" {
+		return 0, nil
+	}
+	warmup, err := time.ParseDuration(os.Getenv("AlarmWarmupPeriod"))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to parse AlarmWarmupPeriod")
+	}
+	return warmup, nil
+}
+
+// suppressAlarmsForWarmup disables the actions of the alarms of the DB cluster members for the AlarmWarmupPeriod, so
+// that the alarms do not fire while the buffer cache of the scaled instances is cold.
+func suppressAlarmsForWarmup(client *cloudwatch.CloudWatch, dbClusterIdentifier string, members map[string]ClusterMemberState) error {
+	warmup, err := getAlarmWarmupPeriod()
+	if err != nil || warmup == 0 {
+		return err
+	}
+
+	var names []string
+	for identifier := range members {
+		for _, template := range AlarmTemplates {
+			names = append(names, template.alarmName(identifier))
+		}
+	}
+	alarmNames, err := getAlarmsWithActionsEnabled(client, names)
+	if err != nil {
+		return err
+	}
+	if len(alarmNames) == 0 {
+		log.Infof("DB cluster (%s) Cloudwatch alarms have no actions enabled, skipping the warmup suppression", dbClusterIdentifier)
+		return nil
+	}
+
+	// The suppression is saved first, so that the alarm actions are enabled again even when the run stops right after
+	// disabling them.
+	suppression := AlarmSuppression{
+		DBClusterIdentifier: dbClusterIdentifier,
+		AlarmNames:          alarmNames,
+		EnableAt:            time.Now().UTC().Add(warmup),
+	}
+	err = updateState(func(state *State) error {
+		state.AlarmSuppressions = append(state.AlarmSuppressions, suppression)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Disabling actions of the DB cluster (%s) Cloudwatch alarms for a warmup period of %s", dbClusterIdentifier, warmup)
+	_, err = client.DisableAlarmActions(&cloudwatch.DisableAlarmActionsInput{AlarmNames: aws.StringSlice(alarmNames)})
+	if err != nil {
+		// Some of the alarms may have been disabled before the failure.
+		_, enableErr := client.EnableAlarmActions(&cloudwatch.EnableAlarmActionsInput{AlarmNames: aws.StringSlice(alarmNames)})
+		if enableErr != nil {
+			log.WithError(enableErr).Errorf("Failed to enable DB cluster (%s) Cloudwatch alarm actions, keeping the suppression until the warmup period is over", dbClusterIdentifier)
+			return errors.Wrap(err, "unable to disable Cloudwatch alarm actions")
+		}
+		removeErr := removeAlarmSuppression(suppression)
+		if removeErr != nil {
+			log.WithError(removeErr).Error("Failed to remove alarm suppression from state")
+		}
+		return errors.Wrap(err, "unable to disable Cloudwatch alarm actions")
+	}
+
+	err = sendMattermostAlarmSuppressionNotification(suppression, false)
+	if err != nil {
+		log.WithError(err).Error("failed to send Mattermost notification")
+	}
+	return nil
+}
+
+// getAlarmsWithActionsEnabled returns the names of the existing alarms whose actions are enabled.
+func getAlarmsWithActionsEnabled(client *cloudwatch.CloudWatch, names []string) ([]string, error) {
+	var enabled []string
+	// DescribeAlarms accepts up to 100 alarm names.
+	for start := 0; start < len(names); start += 100 {
+		end := start + 100
+		if end > len(names) {
+			end = len(names)
+		}
+		err := client.DescribeAlarmsPages(&cloudwatch.DescribeAlarmsInput{AlarmNames: aws.StringSlice(names[start:end])}, func(page *cloudwatch.DescribeAlarmsOutput, lastPage bool) bool {
+			for _, alarm := range page.MetricAlarms {
+				if aws.BoolValue(alarm.ActionsEnabled) {
+					enabled = append(enabled, aws.StringValue(alarm.AlarmName))
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to describe Cloudwatch alarms")
+		}
+	}
+	return enabled, nil
+}
+
+// warnWarmupSuppressionFailure logs and notifies that the alarms of the scaled DB instance could not be suppressed
+// during the warmup period, so that they may fire while the buffer cache is cold.
+func (d *DBInstance) warnWarmupSuppressionFailure(err error) {
+	d.logger().WithError(err).Warnf("Failed to suppress DB instance (%s) Cloudwatch alarms during warmup", d.DBInstanceIdentifier)
+	err = sendMattermostErrorNotification(err, fmt.Sprintf("DB instance (%s) was scaled but its Cloudwatch alarms could not be suppressed during warmup", d.DBInstanceIdentifier))
+	if err != nil {
+		d.logger().WithError(err).Error("failed to send Mattermost notification")
+	}
+}
+
+// removeAlarmSuppression removes the suppression from the state.
+func removeAlarmSuppression(suppression AlarmSuppression) error {
+	return updateState(func(state *State) error {
+		var remaining []AlarmSuppression
+		for _, current := range state.AlarmSuppressions {
+			if current.DBClusterIdentifier == suppression.DBClusterIdentifier && current.EnableAt.Equal(suppression.EnableAt) {
+				continue
+			}
+			remaining = append(remaining, current)
+		}
+		state.AlarmSuppressions = remaining
+		return nil
+	})
+}
+
+// processAlarmSuppressions enables the actions of the alarms whose warmup period is over.
+func processAlarmSuppressions() error {
+	now := time.Now().UTC()
+	var due []AlarmSuppression
+	err := updateState(func(state *State) error {
+		var remaining []AlarmSuppression
+		for _, suppression := range state.AlarmSuppressions {
+			if now.Before(suppression.EnableAt) {
+				remaining = append(remaining, suppression)
+				continue
+			}
+			due = append(due, suppression)
+		}
+		state.AlarmSuppressions = remaining
+		return nil
+	})
+	if err != nil || len(due) == 0 {
+		return err
+	}
+
+	clients, err := getAWSClients()
+	if err != nil {
+		restoreAlarmSuppressions(due)
+		return errors.Wrap(err, "Failed to initiate AWS Clients")
+	}
+
+	for i, suppression := range due {
+		log.Infof("Warmup period of DB cluster (%s) is over, enabling Cloudwatch alarm actions", suppression.DBClusterIdentifier)
+		_, err = clients.CloudWatch.EnableAlarmActions(&cloudwatch.EnableAlarmActionsInput{AlarmNames: aws.StringSlice(suppression.AlarmNames)})
+		if err != nil {
+			restoreAlarmSuppressions(due[i:])
+			return errors.Wrapf(err, "Failed to enable DB cluster (%s) Cloudwatch alarm actions", suppression.DBClusterIdentifier)
+		}
+
+		err = sendMattermostAlarmSuppressionNotification(suppression, true)
+		if err != nil {
+			log.WithError(err).Error("failed to send Mattermost notification")
+		}
+	}
+	return nil
+}
+
+// restoreAlarmSuppressions stores again the suppressions whose alarm actions could not be enabled, so that the next
+// run retries them.
+func restoreAlarmSuppressions(suppressions []AlarmSuppression) {
+	err := updateState(func(state *State) error {
+		state.AlarmSuppressions = append(state.AlarmSuppressions, suppressions...)
+		return nil
+	})
+	if err != nil {
+		log.WithError(err).Error("Failed to save state")
+	}
+}